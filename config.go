@@ -1,12 +1,33 @@
 package config
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image/color"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pelletier/go-toml"
 )
@@ -14,26 +35,383 @@ import (
 // Basis is an enum used for indicating the basis for locating the config file.
 type Basis int
 
+// MergeMode is an enum used for indicating how values from several config files are combined.
+type MergeMode int
+
+const (
+	// MergeOverride makes values in later files replace those already loaded from earlier ones.
+	MergeOverride MergeMode = iota
+	// MergeKeepExisting makes values already loaded from earlier files take precedence, so that later
+	// files only fill in keys which are missing, as when loading user config and then bundled defaults.
+	MergeKeepExisting
+)
+
 // Config stores parameters and data needed for loading the configuration from files and the environment.
 type Config struct {
 	AppName      string // Application name
 	FileBase     string // Base name for config file, default "config"
 	Location     Basis  // Where to locate the config, default ORelativeToUser
 	fileData     *toml.Tree
-	Errors       []error  // List of errors encountered while trying to load the config
-	TrueStrings  []string // String values which count as `true` (case-insensitive), default `["true"]`
-	FalseStrings []string // String values which count as `false` (case-insensitive), default `["false"]`
+	loadedFile   string
+	loadedFormat string
+	loadedDir    string
+	keyInfo      map[string]keyInfo // Where each key was loaded from and how its value was written
+	editable     bool               // Whether loadedFile can be updated by editing its text
+	merged       bool               // Whether the data was merged from several files, ending with loadedFile
+	changed      []string           // Keys passed to Set since the file was loaded
+	parent       *Config
+	keyPrefix    string
+	debugOut     io.Writer
+	// mu guards the state recorded while resolving, so that a loaded Config can be read from several
+	// goroutines: the fields from origins to warnedKeys, and Errors, DroppedErrors and Warnings.
+	mu         sync.Mutex
+	origins    map[*string]fileValue // Values returned by FromFile since the data was loaded
+	fileValues map[string]*string    // The value returned by FromFile for each full file key
+	envOrigins map[*string]string    // Variables behind values returned by FromEnv, when EnvDebug is set
+	envValues  map[string]*string    // The value returned by FromEnv for each variable, when EnvDebug is set
+	accepted   *string               // Value most recently accepted by a resolver, tracked when EnvDebug is set
+	resolving  string                // Name of the setting being resolved, for tagErrors
+	warnedKeys map[string]bool       // Ambiguous keys already warned about by foldKey
+	required   []string
+	aliases    map[string][]string
+	logger     Logger
+	Errors     []error // List of errors encountered while trying to load the config
+	// Warnings lists non-fatal problems, such as use of deprecated variables, which should be reported
+	// but needn't stop the application. Anything which means a value couldn't be used is an error.
+	Warnings     []error
+	TrueStrings  []string    // String values which count as `true` (case-insensitive), default `["true"]`
+	FalseStrings []string    // String values which count as `false` (case-insensitive), default `["false"]`
+	FilePerm     os.FileMode // Permissions for config files written by WriteFile, default 0600
+	Environment  string      // Optional section such as "production" whose keys take precedence in FromFile
+	// DefaultEnvironment is the Environment used by UseEnvironmentFromEnv when the variable is unset or
+	// empty, default "development".
+	DefaultEnvironment string
+	IncludeKey         string // Key listing other files for Load to include, default "include", "" to disable
+	// TrimValues makes FromEnv and FromFile remove leading and trailing whitespace from values, so that
+	// ResolveString, ResolveInt, ResolveFloat64, ResolveBool and so on all see trimmed values. Default false.
+	TrimValues bool
+	// TreatEmptyAsUnset makes ResolveString and ResolveStringPtr skip empty values, as all the other
+	// resolvers always do. Default false, so that an empty value such as a blank environment variable is
+	// a valid string setting which stops resolution.
+	TreatEmptyAsUnset bool
+	// MaxErrors caps the number of errors retained in Errors. Once it's reached, further errors are
+	// counted in DroppedErrors instead. Default 0 for no limit; a negative value retains no errors.
+	MaxErrors     int
+	DroppedErrors int // Number of errors not retained because of MaxErrors
+	// OnError, if set, is called with every error as it occurs, including ones which MaxErrors then
+	// drops, so that errors can be streamed to a logger rather than retained.
+	OnError func(err error)
+	// CaseInsensitiveKeys makes FromFile and the other file lookups match keys regardless of case, so
+	// that `Port` in the file is found by FromFile("port"). An exact match always takes precedence. If
+	// a file has several keys differing only in case and none of them matches exactly, the first in
+	// sorted order is used and a warning is appended to Config.Warnings. Note that this means which
+	// value wins doesn't depend on the order of the keys in the file, and adding a key which differs
+	// only in case can silently change the result for code which looked up a third spelling, so
+	// check Warnings. Default false.
+	CaseInsensitiveKeys bool
+	// TreatEmptyEnvAsUnset makes FromEnv and the other environment lookups return nil for variables
+	// which are set to the empty string, so that a blank variable no longer stops resolution and a
+	// lower priority value such as the config file or default is used instead. Default false, for
+	// compatibility.
+	TreatEmptyEnvAsUnset bool
+	// MergeMode controls how FindAndLoadAll and LoadMergeGlob combine files. The default, MergeOverride,
+	// has later files override earlier ones, matching the usual `conf.d` convention where files are
+	// loaded from most general to most specific.
+	MergeMode MergeMode
+	// EvalSymlinks makes FileFromExecutable and Executable resolve symbolic links in the executable's path,
+	// so that when the binary is symlinked into somewhere like /usr/local/bin, the config is looked for
+	// next to the actual binary rather than next to the link. Default false.
+	EvalSymlinks bool
+	// EnvPrefix, if set, is used by EnvKey as the prefix for environment variable names instead of the
+	// uppercased AppName and an underscore, so EnvPrefix "APP_" makes key `db.host` correspond to
+	// APP_DB_HOST. It's used as is, without adding an underscore.
+	EnvPrefix string
+	// EnvKeyNoPrefix makes EnvKey leave out the AppName prefix, so that key `db.host` corresponds to
+	// environment variable DB_HOST rather than MYAPP_DB_HOST. It overrides EnvPrefix. Default false.
+	EnvKeyNoPrefix bool
+	// GroupSeparators lists the characters which ResolveFloatLocale ignores as digit group separators,
+	// default ",". DecimalSeparator is the decimal point it accepts, default ".". For German style
+	// numbers such as `1.234,56`, set GroupSeparators to "." and DecimalSeparator to ",".
+	GroupSeparators  string
+	DecimalSeparator string
+	// EnvDebug makes the named resolvers, such as ResolveStringNamed and MustResolveIntNamed, and
+	// Populate and UnmarshalKey print each setting's selected value and where it came from to stderr,
+	// such as `resolved db.host from MYAPP_DB_HOST = "example.com"`, so that configuration problems can
+	// be diagnosed in the field. The other resolvers don't print anything, since they aren't given the
+	// setting's name. Values of settings whose names look like secrets, such as `db.password` or
+	// `api_token`, are redacted. New enables it if the environment variable APPNAME_CONFIG_DEBUG is set
+	// to a true value as understood by strconv.ParseBool, such as `1` or `true`.
+	EnvDebug bool
+	// Strict makes Populate and UnmarshalKey report keys in the config file which don't correspond to any
+	// field of the struct, so that typos and settings left over from old versions are caught. For
+	// UnmarshalKey only keys under the prefix are checked. If Environment is set, keys in other top level
+	// tables which override known keys, such as `staging.port` when Environment is "production", are
+	// assumed to belong to other environments and aren't reported. Each unknown key results in an error
+	// matching ErrUnknownKey. Default false.
+	Strict bool
+	// LookupEnv looks up environment variables, default os.LookupEnv. Replace it to supply a fake
+	// environment for testing, or some other source of variables such as a secrets store.
+	LookupEnv func(key string) (string, bool)
 }
 
 // New returns a Config object which can be used to look up configuration values from the environment
 // and from a TOML file.
 func New(appname string) *Config {
 	return &Config{
-		AppName:      appname,
-		FileBase:     "config",
-		TrueStrings:  []string{"true"},
-		FalseStrings: []string{"false"},
+		AppName:            appname,
+		FileBase:           "config",
+		TrueStrings:        []string{"true"},
+		FalseStrings:       []string{"false"},
+		FilePerm:           0600,
+		IncludeKey:         "include",
+		DefaultEnvironment: "development",
+		LookupEnv:          os.LookupEnv,
+		GroupSeparators:    ",",
+		EnvDebug:           envDebug(appname),
+		DecimalSeparator:   ".",
+	}
+}
+
+// envDebug reports whether the APPNAME_CONFIG_DEBUG environment variable enables EnvDebug.
+func envDebug(appname string) bool {
+	b, _ := strconv.ParseBool(os.Getenv(envName(appname, "config_debug")))
+	return b
+}
+
+// Sub returns a Config scoped to the TOML table with the given dotted key prefix, so that FromFile("host")
+// on the result looks up `prefix.host` in the file. It shares the parent's settings, and any errors
+// encountered by the sub-config are appended to the parent's Errors rather than its own. If the table
+// doesn't exist, the sub-config behaves as if no file was loaded. If Config.Environment is set, values in
+// the environment's section take precedence as they do for FromFile, so that with Environment "production",
+// FromFile("host") on Sub("database") checks `production.database.host` before `database.host`.
+func (c *Config) Sub(prefix string) *Config {
+	sub := &Config{
+		AppName:              c.AppName,
+		FileBase:             c.FileBase,
+		Location:             c.Location,
+		parent:               c,
+		keyPrefix:            c.keyPrefix + prefix + ".",
+		TrueStrings:          c.TrueStrings,
+		FalseStrings:         c.FalseStrings,
+		FilePerm:             c.FilePerm,
+		Environment:          c.Environment,
+		DefaultEnvironment:   c.DefaultEnvironment,
+		IncludeKey:           c.IncludeKey,
+		LookupEnv:            c.LookupEnv,
+		TrimValues:           c.TrimValues,
+		Strict:               c.Strict,
+		EnvDebug:             c.EnvDebug,
+		TreatEmptyAsUnset:    c.TreatEmptyAsUnset,
+		TreatEmptyEnvAsUnset: c.TreatEmptyEnvAsUnset,
+		MergeMode:            c.MergeMode,
+		EvalSymlinks:         c.EvalSymlinks,
+		EnvKeyNoPrefix:       c.EnvKeyNoPrefix,
+		EnvPrefix:            c.EnvPrefix,
+		GroupSeparators:      c.GroupSeparators,
+		DecimalSeparator:     c.DecimalSeparator,
+		CaseInsensitiveKeys:  c.CaseInsensitiveKeys,
+		MaxErrors:            c.MaxErrors,
+		OnError:              c.OnError,
+	}
+	if c.fileData != nil {
+		sub.fileData = c.subTree(prefix)
+		sub.Environment = ""
+	}
+	return sub
+}
+
+// subTree finds the table with the given key for Sub. If Config.Environment is set and the environment's
+// section also has the table, you get a copy of the table with the environment's values merged over it.
+func (c *Config) subTree(key string) *toml.Tree {
+	var tree *toml.Tree
+	if _, v, ok := c.lookupKey(key); ok {
+		tree, _ = v.(*toml.Tree)
+	}
+	if c.Environment == "" {
+		return tree
+	}
+	_, v, ok := c.lookupKey(c.Environment + "." + key)
+	etree, isTree := v.(*toml.Tree)
+	if !ok || !isTree {
+		return tree
+	}
+	if tree == nil {
+		return etree
+	}
+	merged := copyTree(tree)
+	mergeTrees(merged, copyTree(etree), true)
+	return merged
+}
+
+// Clone returns a copy of the Config with the same settings and an empty Errors list, for resolving
+// a component's settings separately or applying per-request overrides with Set. The loaded file data
+// is copied, so changes to the clone's data don't affect the original.
+func (c *Config) Clone() *Config {
+	var filedata *toml.Tree
+	if c.fileData != nil {
+		filedata = copyTree(c.fileData)
+	}
+	var aliases map[string][]string
+	if c.aliases != nil {
+		aliases = make(map[string][]string, len(c.aliases))
+		for k, v := range c.aliases {
+			aliases[k] = append([]string(nil), v...)
+		}
+	}
+	var info map[string]keyInfo
+	if r := c.root(); r.keyInfo != nil {
+		info = make(map[string]keyInfo, len(r.keyInfo))
+		for k, v := range r.keyInfo {
+			info[k] = v
+		}
+	}
+	return &Config{
+		AppName:              c.AppName,
+		FileBase:             c.FileBase,
+		Location:             c.Location,
+		fileData:             filedata,
+		aliases:              aliases,
+		logger:               c.logger,
+		debugOut:             c.debugOut,
+		loadedFile:           c.loadedFile,
+		loadedDir:            c.loadedDir,
+		keyInfo:              info,
+		editable:             c.editable,
+		changed:              append([]string(nil), c.changed...),
+		keyPrefix:            c.keyPrefix,
+		loadedFormat:         c.loadedFormat,
+		TrueStrings:          append([]string(nil), c.TrueStrings...),
+		FalseStrings:         append([]string(nil), c.FalseStrings...),
+		FilePerm:             c.FilePerm,
+		Environment:          c.Environment,
+		DefaultEnvironment:   c.DefaultEnvironment,
+		IncludeKey:           c.IncludeKey,
+		LookupEnv:            c.LookupEnv,
+		TrimValues:           c.TrimValues,
+		Strict:               c.Strict,
+		EnvDebug:             c.EnvDebug,
+		TreatEmptyAsUnset:    c.TreatEmptyAsUnset,
+		TreatEmptyEnvAsUnset: c.TreatEmptyEnvAsUnset,
+		MergeMode:            c.MergeMode,
+		EvalSymlinks:         c.EvalSymlinks,
+		EnvKeyNoPrefix:       c.EnvKeyNoPrefix,
+		EnvPrefix:            c.EnvPrefix,
+		GroupSeparators:      c.GroupSeparators,
+		DecimalSeparator:     c.DecimalSeparator,
+		CaseInsensitiveKeys:  c.CaseInsensitiveKeys,
+		MaxErrors:            c.MaxErrors,
+		OnError:              c.OnError,
+	}
+}
+
+// root returns the top-level Config that a sub-config was derived from, or the Config itself.
+func (c *Config) root() *Config {
+	r := c
+	for r.parent != nil {
+		r = r.parent
+	}
+	return r
+}
+
+// addError records an error against the Config, or against its parent if it's a sub-config.
+// The parent's MaxErrors and OnError settings apply.
+func (c *Config) addError(err error) {
+	r := c.root()
+	r.mu.Lock()
+	resolving := r.resolving
+	r.mu.Unlock()
+	if resolving != "" {
+		var ve *ValueError
+		if errors.As(err, &ve) && ve.Key == "" {
+			ve.Key = resolving
+		}
+		err = fmt.Errorf("resolving '%s': %w", resolving, err)
+	}
+	r.log().Errorf("%v", err)
+	if r.OnError != nil {
+		r.OnError(err)
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.MaxErrors < 0 || (r.MaxErrors > 0 && len(r.Errors) >= r.MaxErrors) {
+		r.DroppedErrors++
+		return
+	}
+	r.Errors = append(r.Errors, err)
+}
+
+// errorCount returns the total number of errors recorded, including dropped ones.
+func (c *Config) errorCount() int {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.Errors) + r.DroppedErrors
+}
+
+// errorsSince returns the retained errors recorded since there were n in total, and how many
+// more were dropped. Errors are only dropped once MaxErrors is reached, so the retained ones
+// are always at the end of the Errors list.
+func (c *Config) errorsSince(n int) ([]error, int) {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n > len(r.Errors) {
+		n = len(r.Errors)
+	}
+	errs := r.Errors[n:]
+	return errs, len(r.Errors) + r.DroppedErrors - n - len(errs)
+}
+
+// addWarning records a non-fatal problem against the Config, or against its parent if it's a sub-config.
+func (c *Config) addWarning(err error) {
+	r := c.root()
+	r.log().Warnf("%v", err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Warnings = append(r.Warnings, err)
+}
+
+// HasWarnings reports whether any warnings have been recorded in Config.Warnings.
+func (c *Config) HasWarnings() bool {
+	return len(c.root().Warnings) > 0
+}
+
+// ClearErrors discards any errors accumulated so far and resets DroppedErrors, so that a long-running
+// process can check for errors from each round of loading and resolving separately. On a sub-config
+// it clears the errors of the parent Config, where they are recorded.
+func (c *Config) ClearErrors() {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Errors = nil
+	r.DroppedErrors = 0
+}
+
+// UniqueErrors returns the errors in Config.Errors with duplicates removed, so that an error which
+// occurred several times, such as the same file being unreadable from more than one place, is
+// only reported once. Errors count as duplicates if their messages are identical; the first of each
+// is kept. Config.Errors itself is unchanged.
+func (c *Config) UniqueErrors() []error {
+	seen := make(map[string]bool)
+	var errs []error
+	for _, err := range c.root().Errors {
+		msg := err.Error()
+		if !seen[msg] {
+			seen[msg] = true
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// SortedErrors is like UniqueErrors, but returns the errors sorted by message, so that output and
+// tests don't depend on the order in which settings were resolved.
+func (c *Config) SortedErrors() []error {
+	errs := c.UniqueErrors()
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	return errs
 }
 
 // --- File resolving ---
@@ -41,14 +419,23 @@ func New(appname string) *Config {
 // FileFromExecutable computes the config file name based on the location of executable.
 // Used for cloud applications.
 func (c *Config) FileFromExecutable() string {
-	dir, err := os.Executable()
+	dir, err := c.executable()
 	if err != nil {
-		c.Errors = append(c.Errors, err)
+		c.addError(err)
 		return ""
 	}
 	return filepath.Join(filepath.Dir(dir), c.FileBase+".toml")
 }
 
+// executable returns the path of the executable, with symbolic links resolved if Config.EvalSymlinks is set.
+func (c *Config) executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil || !c.EvalSymlinks {
+		return exe, err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
 // FileFromHome looks for the config file in the standard location for the user's OS, as per Go's
 // `os.UserConfigDir`. Example default filenames:
 //  Linux: ~/.config/AppName/config.toml
@@ -57,12 +444,67 @@ func (c *Config) FileFromExecutable() string {
 func (c *Config) FileFromHome() string {
 	dir, err := os.UserConfigDir()
 	if err != nil {
-		c.Errors = append(c.Errors, err)
+		c.addError(err)
 		return ""
 	}
 	return filepath.Join(dir, c.AppName, c.FileBase+".toml")
 }
 
+// FilesFromHome is like FileFromHome, but returns a candidate file name for each of the given base names
+// in turn, for passing to Find when several conventional names are accepted. For example,
+// FilesFromHome("config", "myapp") on Linux gives ~/.config/AppName/config.toml and
+// ~/.config/AppName/myapp.toml. With no base names, Config.FileBase is used.
+func (c *Config) FilesFromHome(bases ...string) []string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		c.addError(err)
+		return nil
+	}
+	return c.candidates(filepath.Join(dir, c.AppName), bases)
+}
+
+// FilesFromExecutable is like FileFromExecutable, but returns a candidate file name for each of the
+// given base names in turn, as for FilesFromHome.
+func (c *Config) FilesFromExecutable(bases ...string) []string {
+	exe, err := c.executable()
+	if err != nil {
+		c.addError(err)
+		return nil
+	}
+	return c.candidates(filepath.Dir(exe), bases)
+}
+
+// candidates returns the TOML file names for the base names in the directory, or for Config.FileBase
+// if there are no base names.
+func (c *Config) candidates(dir string, bases []string) []string {
+	if len(bases) == 0 {
+		bases = []string{c.FileBase}
+	}
+	files := make([]string, len(bases))
+	for i, base := range bases {
+		files[i] = filepath.Join(dir, base+".toml")
+	}
+	return files
+}
+
+// FileFromEnv returns the config file name given by the specified environment variable, such as
+// `MYAPP_CONFIG=/path/to/config.toml`. Unset or empty variables result in `""`. It's intended to be
+// the first element passed to FindAndLoad, so that an explicit override always wins; if the variable
+// names a file which doesn't exist, an error is appended to Config.Errors.
+func (c *Config) FileFromEnv(key string) string {
+	fn, _ := c.lookupEnv(key)
+	if fn == "" {
+		return ""
+	}
+	exists, err := fileExists(fn)
+	if err != nil {
+		c.addError(err)
+	} else if !exists {
+		c.addError(fmt.Errorf("config file %s specified by %s: %w", fn, key, ErrFileNotFound))
+	}
+	return fn
+}
+
 func fileExists(name string) (bool, error) {
 	_, err := os.Stat(name)
 	if os.IsNotExist(err) {
@@ -76,15 +518,26 @@ func fileExists(name string) (bool, error) {
 
 // Find locates the first extant TOML file by checking the supplied list of possible locations.
 // Empty strings are ignored. It returns the filename.
+//
+// If a file exists but can't be read because of its permissions, an error is appended to Config.Errors
+// and Find returns an empty string, rather than silently falling back to a lower priority file.
 func (c *Config) Find(list ...string) string {
 	for _, elem := range list {
 		if elem != "" {
 			exists, err := fileExists(elem)
 			if err != nil {
-				fmt.Printf("%v", err)
+				if os.IsPermission(err) {
+					c.addError(fmt.Errorf("config file %s can't be checked: %w", elem, err))
+					return ""
+				}
+				c.addError(err)
 				continue
 			}
 			if exists {
+				if err = checkReadable(elem); err != nil {
+					c.addError(fmt.Errorf("config file %s found but unreadable: %w", elem, err))
+					return ""
+				}
 				return elem
 			}
 		}
@@ -92,207 +545,2614 @@ func (c *Config) Find(list ...string) string {
 	return ""
 }
 
-// Load loads the TOML config file specified. Any errors are appended to Config.Errors
-func (c *Config) Load(filename string) {
-	pf, err := os.Open(filename)
+// FindWithExtensions looks in dir for a config file with the given base name and each of the extensions
+// in turn, such as `config.toml` then `config.json`, and returns the name of the first which exists, as
+// for Find. Extensions can be given with or without the leading dot. If none are given, the formats
+// Load supports are tried in the order toml, json, ini. Load uses the extension of the file found to
+// choose its parser.
+func (c *Config) FindWithExtensions(dir string, base string, exts ...string) string {
+	if len(exts) == 0 {
+		exts = []string{"toml", "json", "ini"}
+	}
+	files := make([]string, len(exts))
+	for i, ext := range exts {
+		files[i] = filepath.Join(dir, base+"."+strings.TrimPrefix(ext, "."))
+	}
+	return c.Find(files...)
+}
+
+// FindUpward looks for the config file FileBase.toml in startDir, then in each of its parent directories
+// in turn up to the root of the filesystem, the way git finds the .git directory of a project. It
+// returns the name of the first file found, or an empty string if there isn't one. If startDir is
+// empty, the search starts in the current directory. Files which exist but can't be read are treated
+// as for Find, which means the search stops.
+func (c *Config) FindUpward(startDir string) string {
+	if startDir == "" {
+		startDir = "."
+	}
+	dir, err := filepath.Abs(startDir)
 	if err != nil {
-		c.Errors = append(c.Errors, err)
-		return
+		c.addError(err)
+		return ""
 	}
-	defer func() {
-		err = pf.Close()
-		if err != nil {
-			c.Errors = append(c.Errors, err)
+	n := c.errorCount()
+	for {
+		fn := filepath.Join(dir, c.FileBase+".toml")
+		if found := c.Find(fn); found != "" || c.errorCount() > n {
+			return found
 		}
-	}()
-	filedata, err := toml.LoadReader(pf)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// checkReadable checks that a file can be opened for reading.
+func checkReadable(name string) error {
+	f, err := os.Open(name)
 	if err != nil {
-		c.Errors = append(c.Errors, err)
-		return
+		return err
 	}
-	c.fileData = filedata
+	return f.Close()
 }
 
-// FindAndLoad locates the first config file from the list of possibilities, then loads it.
-// Empty strings are ignored, and the name of the file that was loaded is returned.
-// It's equivalent to Find followed by Load.
-func (c *Config) FindAndLoad(list ...string) string {
-	fn := c.Find(list...)
-	if fn != "" {
-		c.Load(fn)
+// Load loads the config file specified. Files with a `.ini` or `.cfg` extension are parsed as INI files,
+// files with a `.json` extension as JSON, and anything else as TOML. If the file has a Config.IncludeKey value listing other files, those are loaded
+// too, see below. Any errors are appended to Config.Errors
+func (c *Config) Load(filename string) {
+	info := make(map[string]keyInfo)
+	filedata, err := c.loadFile(nil, filename, make(map[string]bool), info)
+	if err != nil {
+		c.addError(err)
+		c.CheckRequired()
+		return
 	}
-	return fn
+	format := fileFormat(filename)
+	c.setLoaded(filedata, info, filename, format, absDir(filename), format == "toml")
 }
 
-// --- value resolution
+// setLoaded makes the tree the loaded config data, with info recording where each of its keys came from.
+// The name is the file or URL it was loaded from, if any, and dir is the directory relative paths in it are resolved against. If editable is set, WriteFile and
+// Save can update the file by editing its text. The records of where earlier values came from and of
+// ambiguous keys already warned about are discarded, so that they don't accumulate when the config is
+// reloaded.
+func (c *Config) setLoaded(tree *toml.Tree, info map[string]keyInfo, name string, format string, dir string, editable bool) {
+	c.fileData = tree
+	c.loadedFile = name
+	c.loadedDir = dir
+	c.keyInfo = info
+	c.merged = false
+	c.loadedFormat = format
+	c.editable = editable
+	c.changed = nil
+	r := c.root()
+	r.mu.Lock()
+	r.origins = nil
+	r.fileValues = nil
+	r.envOrigins = nil
+	r.envValues = nil
+	r.warnedKeys = nil
+	r.mu.Unlock()
+	if name == "" {
+		c.log().Debugf("loaded %s config from reader", format)
+	} else {
+		c.log().Debugf("loaded config from %s", name)
+	}
+	c.CheckRequired()
+}
 
-// ResolveString loops through the listed possible values to find a non-missing one,
-// and return it. If no values are present, you get the zero string `""`.
-func (c *Config) ResolveString(list ...*string) string {
-	for _, elem := range list {
-		if elem != nil {
-			return *elem
-		}
+// LoadFS is like Load, but reads the config file from a filesystem such as an embed.FS, so that default
+// config compiled into the application with `//go:embed` can be loaded directly. Includes are read from
+// the same filesystem. Any errors are appended to Config.Errors
+func (c *Config) LoadFS(fsys fs.FS, name string) {
+	info := make(map[string]keyInfo)
+	filedata, err := c.loadFile(fsys, name, make(map[string]bool), info)
+	if err != nil {
+		c.addError(err)
+		return
 	}
-	c.Errors = append(c.Errors, fmt.Errorf("missing default string value"))
-	return ""
+	c.setLoaded(filedata, info, name, fileFormat(name), "", false)
 }
 
-// toString converts an int, bool or string to a string; anything else ends up as empty string
-func (c *Config) toString(x interface{}) string {
-	switch v := x.(type) {
-	case int64:
-		return strconv.FormatInt(v, 10)
-	case int:
-		return strconv.FormatInt(int64(v), 10)
-	case bool:
-		return strconv.FormatBool(v)
-	case float64:
-		return strconv.FormatFloat(v, 'f', -1, 64)
-	case string:
-		return v
+// LoadReader loads config data in the specified format, "toml", "ini" or "json", from a reader such as os.Stdin.
+// Includes aren't processed, as there's no file to find them relative to. Any error is returned, and also
+// appended to Config.Errors.
+func (c *Config) LoadReader(r io.Reader, format string) error {
+	filedata, decimal, err := parseReader(r, format)
+	if err != nil {
+		c.addError(err)
+		return err
 	}
-	c.Errors = append(c.Errors, fmt.Errorf("unexpected data type %T", x))
-	return ""
+	info := make(map[string]keyInfo)
+	recordKeys(info, "", filedata, decimal)
+	c.setLoaded(filedata, info, "", format, "", false)
+	return nil
 }
 
-// ResolveInt loops through the listed possible values to find a non-missing one,
-// then parses it and casts it to an integer. If no values are present,
-// you get the zero integer value `0`. Floating point values are rounded down.
-func (c *Config) ResolveInt(list ...*string) int {
-	for _, elem := range list {
-		if elem != nil && *elem != "" {
-			var val int64
-			var err error
-			if strings.Contains(*elem, ".") {
-				var v float32
-				var tv float64
-				tv, err = strconv.ParseFloat(*elem, 64)
-				v = float32(tv)
-				val = int64(v)
-			} else {
-				val, err = strconv.ParseInt(*elem, 0, 64)
-			}
-			if err != nil {
-				c.Errors = append(c.Errors, fmt.Errorf("unrecognized numeric value '%s': %w", *elem, err))
-			} else {
-				return int(val)
-			}
-		}
+// LoadURL fetches config data over HTTP or HTTPS and loads it. The format is taken from the response's
+// Content-Type if it's a TOML, INI or JSON type such as `application/toml` or `text/x-ini`, otherwise from
+// the extension of the URL path as for Load. The context controls the request, so it can be used to set a
+// timeout. Responses larger than 10 MiB are rejected. Includes aren't processed.
+// Network errors, non-2xx responses and parse errors are returned, and also appended to Config.Errors.
+// LoadedFile reports the URL.
+func (c *Config) LoadURL(ctx context.Context, rawurl string) error {
+	filedata, decimal, format, err := fetchURL(ctx, rawurl)
+	if err != nil {
+		c.addError(err)
+		return err
 	}
-	c.Errors = append(c.Errors, fmt.Errorf("missing default int value"))
-	return 0
+	info := make(map[string]keyInfo)
+	recordKeys(info, "", filedata, decimal)
+	c.setLoaded(filedata, info, rawurl, format, "", false)
+	return nil
 }
 
-// ResolveFloat64 loops through the listed possible values to find a non-missing one,
-// then parses it and casts it to a float64. If no values are present,
-// you get the zero value.
-func (c *Config) ResolveFloat64(list ...*string) float64 {
-	for _, elem := range list {
-		if elem != nil && *elem != "" {
-			val, err := strconv.ParseFloat(*elem, 64)
-			if err != nil {
-				c.Errors = append(c.Errors, fmt.Errorf("unrecognized numeric value '%s': %w", *elem, err))
-			} else {
-				return val
-			}
-		}
+// maxURLSize is the largest response LoadURL accepts, in bytes.
+var maxURLSize = 10 << 20
+
+// fetchURL fetches and parses config data from a URL, returning it along with the keys of
+// its decimal integers, as for parseReader, and its format.
+func fetchURL(ctx context.Context, rawurl string) (*toml.Tree, map[string]bool, string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, nil, "", err
 	}
-	c.Errors = append(c.Errors, fmt.Errorf("missing default int value"))
-	return 0.0
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, "", fmt.Errorf("fetching config from %s: %s", rawurl, resp.Status)
+	}
+	format := fileFormat(u.Path)
+	if ctype := contentFormat(resp.Header.Get("Content-Type")); ctype != "" {
+		format = ctype
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxURLSize)+1))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("fetching config from %s: %w", rawurl, err)
+	}
+	if len(body) > maxURLSize {
+		return nil, nil, "", fmt.Errorf("fetching config from %s: response is larger than %d bytes", rawurl, maxURLSize)
+	}
+	tree, decimal, err := parseReader(bytes.NewReader(body), format)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("%s: %w", rawurl, err)
+	}
+	return tree, decimal, format, nil
 }
 
-// stringToBool interprets a string as a bool, given the lists of TrueStrings and FalseStrings.
-// If there's a match, you get the decoded boolean, and ok = true.
-// Values which don't match either list result in ok = false.
-func (c *Config) stringToBool(bs string) (value bool, ok bool) {
-	tbs := strings.TrimSpace(bs)
-	for _, ts := range c.TrueStrings {
-		if strings.EqualFold(tbs, ts) {
-			return true, true
-		}
+// contentFormat returns the config format for a Content-Type such as `application/toml`, `text/x-ini` or
+// `application/vnd.example+json`, or the empty string if it isn't one of the supported formats.
+func contentFormat(ctype string) string {
+	mtype, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return ""
 	}
-	for _, ts := range c.FalseStrings {
-		if strings.EqualFold(tbs, ts) {
-			return false, true
-		}
+	sub := mtype[strings.Index(mtype, "/")+1:]
+	if i := strings.LastIndex(sub, "+"); i >= 0 {
+		sub = sub[i+1:]
 	}
-	return false, false
+	switch sub = strings.TrimPrefix(sub, "x-"); sub {
+	case "toml", "ini", "json":
+		return sub
+	}
+	return ""
 }
 
-// ResolveBool loops through the listed possible values to find a non-missing one,
-// then parses it and casts it to a boolean. If no values are present,
-// you get the zero boolean value `false`.
-func (c *Config) ResolveBool(list ...*string) bool {
-	for _, elem := range list {
-		if elem != nil && *elem != "" {
-			b, ok := c.stringToBool(*elem)
+// loadFile reads and parses a config file, then processes any includes it has. If fsys is nil, the file is
+// read from the operating system's filesystem, otherwise from fsys. The seen map contains the cleaned
+// absolute names of the files in the current chain of includes, to detect cycles. If dirs isn't nil, the
+// directory of the file each key comes from is recorded in it, for files read from the operating system.
+//
+// Included files are loaded relative to the directory of the file including them, and merged in the order
+// listed, so later files override earlier ones. Values in the including file override all of the included
+// files. The include key itself is removed from the merged data.
+func (c *Config) loadFile(fsys fs.FS, filename string, seen map[string]bool, info map[string]keyInfo) (*toml.Tree, error) {
+	absname := path.Clean(filename)
+	if fsys == nil {
+		var err error
+		if absname, err = filepath.Abs(filename); err != nil {
+			return nil, err
+		}
+	}
+	if seen[absname] {
+		return nil, fmt.Errorf("include cycle detected at %s", filename)
+	}
+	seen[absname] = true
+	defer delete(seen, absname)
+	tree, decimal, err := readFile(fsys, filename)
+	if err != nil {
+		return nil, err
+	}
+	dir := ""
+	if fsys == nil {
+		dir = absDir(filename)
+	}
+	if c.IncludeKey == "" || !tree.Has(c.IncludeKey) {
+		recordKeys(info, dir, tree, decimal)
+		return tree, nil
+	}
+	var includes []string
+	switch v := tree.Get(c.IncludeKey).(type) {
+	case string:
+		includes = []string{v}
+	case []interface{}:
+		for _, x := range v {
+			inc, ok := x.(string)
 			if !ok {
-				c.Errors = append(c.Errors, fmt.Errorf("unrecognized bool value %s", *elem))
+				return nil, fmt.Errorf("%s: %s must list file names, found %T", filename, c.IncludeKey, x)
 			}
-			return b
+			includes = append(includes, inc)
 		}
+	default:
+		return nil, fmt.Errorf("%s: %s must list file names, found %T", filename, c.IncludeKey, v)
 	}
-	c.Errors = append(c.Errors, fmt.Errorf("missing default bool value"))
-	return false
+	if err = tree.Delete(c.IncludeKey); err != nil {
+		return nil, err
+	}
+	merged := emptyTree()
+	for _, inc := range includes {
+		if fsys != nil {
+			inc = path.Join(path.Dir(filename), inc)
+		} else if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(filename), inc)
+		}
+		itree, err := c.loadFile(fsys, inc, seen, info)
+		if err != nil {
+			return nil, err
+		}
+		mergeTrees(merged, itree, true)
+	}
+	mergeTrees(merged, tree, true)
+	recordKeys(info, dir, tree, decimal)
+	return merged, nil
 }
 
-// FromEnv looks for a value in an environment variable with the specified name.
-func (c *Config) FromEnv(key string) *string {
-	x, ok := os.LookupEnv(key)
-	if ok {
-		return &x
-	}
-	return nil
+// keyInfo records where a loaded key came from: the directory of its file, if it was read from the
+// operating system's filesystem, and whether its value is an integer written in decimal.
+type keyInfo struct {
+	dir     string
+	decimal bool
 }
 
-// FromFile obtains a configuration value from the TOML config file, given a string key.
-func (c *Config) FromFile(key string) *string {
-	if c.fileData == nil {
-		return nil
+// recordKeys records the directory and the decimal integers of a parsed file for each of the keys in the
+// tree, replacing anything already recorded for them, unless info is nil.
+func recordKeys(info map[string]keyInfo, dir string, tree *toml.Tree, decimal map[string]bool) {
+	if info == nil {
+		return
 	}
-	if c.fileData.Has(key) {
-		v := c.fileData.Get(key)
-		x := c.toString(v)
-		return &x
+	for _, key := range appendKeys(nil, "", tree) {
+		info[key] = keyInfo{dir: dir, decimal: decimal[key]}
 	}
-	return nil
 }
 
-// UserHomeDir is a wrapped version of os.UserHomeDir which appends any error to Config.Errors.
-func (c *Config) UserHomeDir() *string {
-	home, err := os.UserHomeDir()
+// readFile opens and parses a single config file according to its format, from fsys if it's non-nil,
+// otherwise from the operating system's filesystem.
+func readFile(fsys fs.FS, filename string) (tree *toml.Tree, decimal map[string]bool, err error) {
+	var pf io.ReadCloser
+	if fsys != nil {
+		pf, err = fsys.Open(filename)
+	} else {
+		pf, err = os.Open(filename)
+	}
 	if err != nil {
-		c.Errors = append(c.Errors, fmt.Errorf("couldn't locate home directory: %w", err))
-		return nil
+		return nil, nil, err
 	}
-	return &home
+	defer func() {
+		cerr := pf.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+	return parseReader(pf, fileFormat(filename))
 }
 
-// UserConfigDir is a wrapped version of os.UserConfigDir which appends any error to Config.Errors.
-func (c *Config) UserConfigDir() *string {
-	home, err := os.UserConfigDir()
-	if err != nil {
-		c.Errors = append(c.Errors, fmt.Errorf("couldn't locate home directory: %w", err))
-		return nil
+// parseReader parses config data in the specified format, "toml", "ini" or "json". It also returns the
+// keys of the integer values which were written as plain decimal numbers, so that ResolveFileMode can
+// tell `644` from `0o644`.
+func parseReader(r io.Reader, format string) (*toml.Tree, map[string]bool, error) {
+	switch format {
+	case "toml":
+		src, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		tree, err := toml.LoadBytes(src)
+		if err != nil {
+			return nil, nil, err
+		}
+		return tree, tomlDecimalInts(string(src), tree), nil
+	case "ini":
+		tree, err := loadINI(r)
+		return tree, nil, err
+	case "json":
+		tree, err := loadJSON(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		decimal := make(map[string]bool)
+		for _, key := range appendKeys(nil, "", tree) {
+			if _, ok := tree.Get(key).(int64); ok {
+				decimal[key] = true
+			}
+		}
+		return tree, decimal, nil
 	}
-	return &home
+	return nil, nil, fmt.Errorf("unsupported config format '%s'", format)
 }
 
-// Executable is a wrapped version of os.Executable which appends any error to Config.Errors.
-func (c *Config) Executable() *string {
-	exe, err := os.Executable()
-	if err != nil {
-		c.Errors = append(c.Errors, fmt.Errorf("couldn't locate executable: %w", err))
-		return nil
+// tomlDecimalInts returns the keys in the tree whose values are integers written in the TOML source
+// without a 0x, 0o or 0b prefix. Values in inline tables are left out, as go-toml doesn't record where
+// their keys are.
+func tomlDecimalInts(src string, tree *toml.Tree) map[string]bool {
+	lines := strings.Split(src, "\n")
+	decimal := make(map[string]bool)
+	for _, key := range appendKeys(nil, "", tree) {
+		if _, ok := tree.Get(key).(int64); !ok {
+			continue
+		}
+		pos := tree.GetPosition(key)
+		if pos.Line < 1 || pos.Line > len(lines) || pos.Col < 1 || pos.Col > len(lines[pos.Line-1]) {
+			continue
+		}
+		line := lines[pos.Line-1][pos.Col-1:]
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			continue
+		}
+		lit := strings.TrimLeft(strings.TrimSpace(line[eq+1:]), "+-")
+		if len(lit) < 2 || lit[0] != '0' || !strings.ContainsRune("xob", rune(lit[1])) {
+			decimal[key] = true
+		}
 	}
-	d := path.Dir(exe)
-	return &d
+	return decimal
 }
 
-// Default wraps an int, bool or string value to act as default when resolving config values.
-func (c *Config) Default(x interface{}) *string {
-	if x != nil {
+// emptyTree returns a new tree containing no values.
+func emptyTree() *toml.Tree {
+	tree, _ := toml.TreeFromMap(map[string]interface{}{})
+	return tree
+}
+
+// copyTree returns a deep copy of a tree.
+func copyTree(src *toml.Tree) *toml.Tree {
+	dst := emptyTree()
+	for _, key := range src.Keys() {
+		path := []string{key}
+		switch v := src.GetPath(path).(type) {
+		case *toml.Tree:
+			dst.SetPath(path, copyTree(v))
+		case []*toml.Tree:
+			trees := make([]*toml.Tree, len(v))
+			for i, t := range v {
+				trees[i] = copyTree(t)
+			}
+			dst.SetPath(path, trees)
+		case []interface{}:
+			dst.SetPath(path, append([]interface{}(nil), v...))
+		default:
+			dst.SetPath(path, v)
+		}
+	}
+	return dst
+}
+
+// mergeTrees merges the values from the src tree into the dst tree, recursing into tables which exist in
+// both. If override is true, values in src replace those in dst, otherwise existing values are kept.
+func mergeTrees(dst *toml.Tree, src *toml.Tree, override bool) {
+	for _, key := range src.Keys() {
+		path := []string{key}
+		sv := src.GetPath(path)
+		dv := dst.GetPath(path)
+		stree, sok := sv.(*toml.Tree)
+		dtree, dok := dv.(*toml.Tree)
+		if sok && dok {
+			mergeTrees(dtree, stree, override)
+			continue
+		}
+		if override || dv == nil {
+			dst.SetPath(path, sv)
+		}
+	}
+}
+
+// RequireKeys registers keys which must be present when a config file is loaded. After Load reads a
+// file, an error is appended to Config.Errors for each required key which is missing from both the
+// file and the environment, where the environment variable name is derived from the AppName and key
+// by EnvKey, e.g. MYAPP_DATABASE_HOST for key `database.host`. The keys are also checked when Load
+// fails, and when FindAndLoad, FindAndLoadAll or LoadMergeGlob find no file to load; see CheckRequired.
+func (c *Config) RequireKeys(keys ...string) {
+	c.required = append(c.required, keys...)
+}
+
+// CheckRequired appends an error to Config.Errors for each key registered with RequireKeys which isn't
+// found in the loaded data or the environment, and returns the errors. It's called automatically by the
+// Load functions, so you only need to call it if you resolve settings without loading a file at all.
+func (c *Config) CheckRequired() []error {
+	var errs []error
+	for _, key := range c.required {
+		if c.Has(key) {
+			continue
+		}
+		env := c.EnvKey(key)
+		if v, ok := c.lookupEnv(env); ok && v != "" {
+			continue
+		}
+		err := &ValueError{Key: key, Err: fmt.Errorf("required key '%s' not found in file or environment variable %s",
+			key, env), kind: ErrMissingValue}
+		c.addError(err)
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// EnvKey derives the conventional environment variable name for a config key, by joining the AppName
+// and key with an underscore, uppercasing, and replacing dots and dashes with underscores. For AppName
+// "myapp", key `db.host` gives MYAPP_DB_HOST. On a sub-config, the key is taken to be relative to the
+// sub-config's table, so Sub("db").EnvKey("host") gives the same result. Config.EnvPrefix replaces the
+// AppName prefix if it's set, and no prefix is used if Config.EnvKeyNoPrefix is set.
+func (c *Config) EnvKey(key string) string {
+	switch {
+	case c.EnvKeyNoPrefix:
+		return envName("", c.keyPrefix+key)
+	case c.EnvPrefix != "":
+		return c.EnvPrefix + envName("", c.keyPrefix+key)
+	default:
+		return envName(c.AppName, c.keyPrefix+key)
+	}
+}
+
+// FromDerivedEnv looks for a value in the environment variable whose name EnvKey derives from the key,
+// so that the variable name and the logical key can't get out of step.
+func (c *Config) FromDerivedEnv(key string) *string {
+	return c.FromEnv(c.EnvKey(key))
+}
+
+// Value looks up a key in the environment variable named by EnvKey, then in the config file, so that
+// every file setting can be overridden from the environment without spelling out the list of sources.
+// Value("server.port") is equivalent to FromDerivedEnv("server.port") followed by FromFile("server.port"),
+// and the result can be passed to any of the resolvers along with a default, e.g.
+//
+//	port := conf.ResolveInt(conf.Value("server.port"), conf.Default(8080))
+func (c *Config) Value(key string) *string {
+	if v := c.FromDerivedEnv(key); v != nil {
+		return v
+	}
+	return c.FromFile(key)
+}
+
+// envName derives the conventional environment variable name for a config key, by joining the
+// application name and key, uppercasing, and replacing dots and dashes with underscores.
+func envName(appname string, key string) string {
+	name := key
+	if appname != "" {
+		name = appname + "_" + key
+	}
+	return strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+}
+
+// fileFormat determines the format of a config file from its extension.
+func fileFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ini", ".cfg":
+		return "ini"
+	case ".json":
+		return "json"
+	}
+	return "toml"
+}
+
+// LoadedFile returns the name of the config file which was successfully loaded, if any, for logging
+// which file won. It's set by all of the Load and FindAndLoad methods; after a merge it's the last file
+// loaded, and after LoadURL it's the URL. If a load fails, the previous value is kept along with the
+// previous data. A sub-config reports the file its parent loaded.
+func (c *Config) LoadedFile() string {
+	if c.parent != nil && c.loadedFormat == "" {
+		return c.parent.LoadedFile()
+	}
+	return c.loadedFile
+}
+
+// absDir returns the absolute path of the directory containing the file, or "" if it can't be determined.
+func absDir(filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return ""
+	}
+	return filepath.Dir(abs)
+}
+
+// LoadedFormat returns the format of the config file which was loaded, `"toml"`, `"ini"` or `"json"`,
+// or an empty string if no file was loaded. A sub-config reports the format its parent loaded.
+func (c *Config) LoadedFormat() string {
+	if c.parent != nil && c.loadedFormat == "" {
+		return c.parent.LoadedFormat()
+	}
+	return c.loadedFormat
+}
+
+// FindAndLoad locates the first config file from the list of possibilities, then loads it.
+// Empty strings are ignored, and the name of the file that was loaded is returned.
+// It's equivalent to Find followed by Load.
+func (c *Config) FindAndLoad(list ...string) string {
+	fn := c.Find(list...)
+	if fn != "" {
+		c.Load(fn)
+	} else {
+		c.CheckRequired()
+	}
+	return fn
+}
+
+// FindAndLoadAll loads every config file in the list which exists, and merges them in order, so that
+// values in later files override those in earlier ones, unless Config.MergeMode is MergeKeepExisting.
+// This is the reverse of the priority order used by FindAndLoad, and suits layering such as system,
+// then user, then local config. Empty strings and
+// missing files are skipped, and the names of the files that were loaded are returned. Files which
+// can't be read or parsed are skipped, with an error appended to Config.Errors. LoadedFile reports the
+// last file loaded.
+func (c *Config) FindAndLoadAll(list ...string) []string {
+	var found []string
+	for _, elem := range list {
+		if elem == "" {
+			continue
+		}
+		exists, err := fileExists(elem)
+		if err != nil {
+			c.addError(fmt.Errorf("config file %s can't be checked: %w", elem, err))
+			continue
+		}
+		if exists {
+			found = append(found, elem)
+		}
+	}
+	return c.loadMerged(found)
+}
+
+// FindGlob returns the names of the files matching the pattern, such as `/etc/myapp/conf.d/*.toml`, in
+// lexical order so that merge precedence is predictable. Directories are ignored. The pattern syntax is
+// that of filepath.Match; a malformed pattern results in an error being appended to Config.Errors.
+func (c *Config) FindGlob(pattern string) []string {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		c.addError(fmt.Errorf("bad config file pattern %s: %w", pattern, err))
+		return nil
+	}
+	sort.Strings(matches)
+	var files []string
+	for _, fn := range matches {
+		if fi, err := os.Stat(fn); err == nil && !fi.IsDir() {
+			files = append(files, fn)
+		}
+	}
+	return files
+}
+
+// LoadMergeGlob loads all of the files matching the pattern, as found by FindGlob, and merges them in
+// lexical order, so that values in `20-local.toml` override those in `10-defaults.toml`, unless
+// Config.MergeMode is MergeKeepExisting. This is the usual `conf.d` arrangement. It returns the names
+// of the files loaded, and like FindAndLoadAll, skips files which can't be loaded with an error appended
+// to Config.Errors.
+func (c *Config) LoadMergeGlob(pattern string) []string {
+	return c.loadMerged(c.FindGlob(pattern))
+}
+
+// loadMerged loads each of the files and merges them in order into a single tree, which becomes the
+// loaded config data if any of them were loaded successfully. It returns the names of the files loaded.
+func (c *Config) loadMerged(files []string) []string {
+	var loaded []string
+	merged := emptyTree()
+	info := make(map[string]keyInfo)
+	for _, fn := range files {
+		finfo := make(map[string]keyInfo)
+		tree, err := c.loadFile(nil, fn, make(map[string]bool), finfo)
+		if err != nil {
+			c.addError(err)
+			continue
+		}
+		mergeTrees(merged, tree, c.MergeMode != MergeKeepExisting)
+		for key, ki := range finfo {
+			if _, ok := info[key]; !ok || c.MergeMode != MergeKeepExisting {
+				info[key] = ki
+			}
+		}
+		loaded = append(loaded, fn)
+	}
+	if len(loaded) == 0 {
+		c.CheckRequired()
+		return nil
+	}
+	last := loaded[len(loaded)-1]
+	c.setLoaded(merged, info, last, fileFormat(last), absDir(last), false)
+	c.merged = true
+	return loaded
+}
+
+// Keys returns the fully qualified dotted keys of all the values in the loaded config data, such as
+// `database.host`, in sorted order. Tables are recursed into rather than listed themselves; arrays of
+// tables are listed as single keys. If no file is loaded, you get an empty list.
+func (c *Config) Keys() []string {
+	keys := []string{}
+	if c.fileData != nil {
+		keys = appendKeys(keys, "", c.fileData)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendKeys appends the keys of the values in the tree to the list, with the given prefix.
+func appendKeys(keys []string, prefix string, tree *toml.Tree) []string {
+	for _, k := range tree.Keys() {
+		if sub, ok := tree.GetPath([]string{k}).(*toml.Tree); ok {
+			keys = appendKeys(keys, prefix+k+".", sub)
+		} else {
+			keys = append(keys, prefix+k)
+		}
+	}
+	return keys
+}
+
+// Set sets a value in the loaded config data, as if it had been read from the file. The key is a
+// dotted path such as `database.host`; any tables needed are created. Go integer and float types such
+// as int and float32 are stored as int64 and float64, the types TOML values are read as, so that they
+// can be written out by WriteFile and Save. On a sub-config, the value is set at the full key in the
+// data of the Config it was derived from too, so that it's saved along with the rest.
+func (c *Config) Set(key string, value interface{}) {
+	value = tomlType(value)
+	full := c.keyPrefix + key
+	for p := c; p != nil; p = p.parent {
+		if p.fileData == nil {
+			p.fileData = emptyTree()
+		}
+		p.fileData.Set(strings.TrimPrefix(full, p.keyPrefix), value)
+	}
+	r := c.root()
+	delete(r.keyInfo, full)
+	r.changed = append(r.changed, full)
+}
+
+// tomlType converts Go integer and float types to the int64 and float64 that go-toml uses for TOML
+// values, and slices of them to slices of those. Other values, and unsigned integers too large for an
+// int64, are returned as they are.
+func tomlType(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		if uint64(v) <= math.MaxInt64 {
+			return int64(v)
+		}
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+	case float32:
+		return float64(v)
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice {
+		return value
+	}
+	elem := rv.Type().Elem()
+	if reflect.TypeOf(tomlType(reflect.Zero(elem).Interface())) == elem {
+		return value
+	}
+	vals := make([]interface{}, rv.Len())
+	for i := range vals {
+		vals[i] = tomlType(rv.Index(i).Interface())
+	}
+	return vals
+}
+
+// WriteFile writes the loaded config data to the specified file in TOML format, creating the parent
+// directory with permissions 0700 if necessary. A new file is created with permissions Config.FilePerm;
+// an existing file keeps its permissions. The data is written to a temporary file in the same directory,
+// which is then renamed over the target, so that if anything goes wrong the original file is left
+// intact rather than truncated. Any errors are appended to Config.Errors.
+//
+// If the file is the TOML file the config was read from by Load, only the lines for the keys changed
+// by Set are rewritten, so that the user's comments and formatting are preserved. If that can't be
+// done, for example because a table was set as a value, the whole file is rewritten as usual.
+func (c *Config) WriteFile(filename string) {
+	tree := c.fileData
+	if tree == nil {
+		tree = emptyTree()
+	}
+	data, err := tree.ToTomlString()
+	if err != nil {
+		c.addError(err)
+		return
+	}
+	if edited, ok := c.editLoadedFile(filename, tree); ok {
+		data = edited
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		c.addError(err)
+		return
+	}
+	if err = writeFileAtomic(filename, []byte(data), c.FilePerm); err != nil {
+		c.addError(err)
+	}
+}
+
+// Save writes the config data back to the file it was loaded from, as for WriteFile. If the data
+// was merged from several files by FindAndLoadAll or LoadMergeGlob, only the keys changed by Set are
+// written, to the last of the files, so that values from the other files aren't copied into it; that
+// file must be TOML. If the data wasn't loaded from a local file, an error is appended to Config.Errors.
+func (c *Config) Save() {
+	r := c.root()
+	if r.loadedDir == "" {
+		r.addError(errors.New("can't save config, it wasn't loaded from a file"))
+		return
+	}
+	if r.merged {
+		r.saveChanges(r.loadedFile)
+		return
+	}
+	r.WriteFile(r.loadedFile)
+}
+
+// saveChanges writes the values of the keys changed by Set into the TOML file, leaving the rest of it
+// as it is, preserving comments if possible.
+func (c *Config) saveChanges(filename string) {
+	if fileFormat(filename) != "toml" {
+		c.addError(fmt.Errorf("can't save changes to %s, only TOML files can be updated", filename))
+		return
+	}
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		c.addError(err)
+		return
+	}
+	data, ok := editTOML(string(src), c.fileData, c.changed)
+	if !ok {
+		tree, err := toml.Load(string(src))
+		if err != nil {
+			c.addError(fmt.Errorf("%s: %w", filename, err))
+			return
+		}
+		for _, key := range c.changed {
+			if v := c.fileData.Get(key); v != nil {
+				tree.Set(key, v)
+			}
+		}
+		if data, err = tree.ToTomlString(); err != nil {
+			c.addError(err)
+			return
+		}
+	}
+	if err = writeFileAtomic(filename, []byte(data), c.FilePerm); err != nil {
+		c.addError(err)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory as filename, then renames it
+// to filename. If filename exists, its permissions are kept, otherwise perm is used. If filename is a
+// symbolic link, the file it points to is replaced.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) (err error) {
+	if real, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = real
+	}
+	if fi, err := os.Stat(filename); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Chmod(perm); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// editLoadedFile returns the text of the file the config was loaded from with the changes made by Set,
+// if filename is that file and it can be edited.
+func (c *Config) editLoadedFile(filename string, tree *toml.Tree) (string, bool) {
+	if c.parent != nil || !c.editable || absDir(filename) != c.loadedDir ||
+		filepath.Base(filename) != filepath.Base(c.loadedFile) {
+		return "", false
+	}
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", false
+	}
+	return editTOML(string(src), tree, c.changed)
+}
+
+// --- value resolution
+
+// ResolveString loops through the listed possible values to find a non-missing one,
+// and return it. If no values are present, you get the zero string `""`. Empty values
+// count as present unless Config.TreatEmptyAsUnset is set. Tables from the config file
+// aren't accepted as string values; they result in an error, and resolution continues
+// with the next value.
+func (c *Config) ResolveString(list ...*string) string {
+	if elem := c.resolveString(list); elem != nil {
+		return *elem
+	}
+	c.addError(missingError("string"))
+	return ""
+}
+
+// ResolveStringPtr is like ResolveString, but returns nil if no values are present, so that you can
+// distinguish a setting which is unset from one which is explicitly set to the empty string.
+// Missing values aren't treated as an error.
+func (c *Config) ResolveStringPtr(list ...*string) *string {
+	if elem := c.resolveString(list); elem != nil {
+		x := *elem
+		return &x
+	}
+	return nil
+}
+
+// ResolveStringNonEmpty is like ResolveString, but always skips empty values, as ResolveInt, ResolveBool
+// and the other resolvers do, whatever the setting of Config.TreatEmptyAsUnset. If no non-empty values are
+// present, you get the zero string `""` and an error.
+func (c *Config) ResolveStringNonEmpty(list ...*string) string {
+	nonempty := make([]*string, 0, len(list))
+	for _, elem := range list {
+		if elem != nil && *elem != "" {
+			nonempty = append(nonempty, elem)
+		}
+	}
+	return c.ResolveString(nonempty...)
+}
+
+// ResolveStringTrimmed is like ResolveString, but removes leading and trailing whitespace from each of the
+// values first, whatever the setting of Config.TrimValues. This is useful for values from sources which
+// TrimValues doesn't apply to, such as a mounted secret file whose contents end with a newline. Values
+// consisting only of whitespace become empty, so they're skipped if Config.TreatEmptyAsUnset is set.
+func (c *Config) ResolveStringTrimmed(list ...*string) string {
+	trimmed := make([]*string, len(list))
+	for i, elem := range list {
+		trimmed[i] = elem
+		if elem != nil {
+			if t := strings.TrimSpace(*elem); t != *elem {
+				trimmed[i] = &t
+			}
+		}
+	}
+	return c.ResolveString(trimmed...)
+}
+
+// ResolveFirst returns the first non-missing value in the list and its index, or nil and -1 if no
+// values are present. Empty values count as present unless Config.TreatEmptyAsUnset is set. It's the
+// basic rule which the other resolvers follow, for use when you need to know which source won, and
+// it doesn't append any errors or check what kind of value it found.
+func (c *Config) ResolveFirst(list ...*string) (value *string, index int) {
+	for i, elem := range list {
+		if elem != nil && !(c.TreatEmptyAsUnset && *elem == "") {
+			return elem, i
+		}
+	}
+	return nil, -1
+}
+
+// resolveString finds the first non-missing string value in the list using ResolveFirst,
+// skipping tables.
+func (c *Config) resolveString(list []*string) *string {
+	for {
+		elem, i := c.ResolveFirst(list...)
+		if elem == nil {
+			return nil
+		}
+		if c.isTable(elem) {
+			list = list[i+1:]
+			continue
+		}
+		c.accept(elem)
+		return elem
+	}
+}
+
+// ResolveStringSlice loops through the listed possible values to find a non-missing one,
+// then splits it into a list of strings. Values starting with `[` are parsed as a JSON array,
+// which is also how arrays from the config file are represented; otherwise the value is split
+// on the separator string, and whitespace is trimmed from each element. Malformed JSON
+// results in an error, and resolution continues with the next value. If no values are present,
+// you get nil.
+func (c *Config) ResolveStringSlice(sep string, list ...*string) []string {
+	for _, elem := range list {
+		if parts := c.splitList(sep, elem); parts != nil {
+			c.accept(elem)
+			return parts
+		}
+	}
+	c.addError(missingError("string slice"))
+	return nil
+}
+
+// ResolveStringCSV is like ResolveStringSlice with separator ",", but values not starting with `[` are
+// parsed as a line of CSV, so that elements containing commas can be quoted, as in
+// `"Smith, John","Doe, Jane"`. Whitespace is trimmed from unquoted elements, but preserved inside
+// quotes. Malformed CSV results in an error, and resolution continues with the next value. If no
+// values are present, you get nil.
+func (c *Config) ResolveStringCSV(list ...*string) []string {
+	for _, elem := range list {
+		if elem == nil || strings.TrimSpace(*elem) == "" {
+			continue
+		}
+		val := strings.TrimSpace(*elem)
+		if strings.HasPrefix(val, "[") {
+			if parts := c.splitList(",", elem); parts != nil {
+				return parts
+			}
+			continue
+		}
+		parts, err := parseCSVLine(val)
+		if err != nil {
+			c.addError(c.valueError(elem, ErrParse,
+				fmt.Errorf("unrecognized CSV value '%s'%s: %w", *elem, c.origin(elem), err)))
+			continue
+		}
+		return parts
+	}
+	c.addError(missingError("string slice"))
+	return nil
+}
+
+// parseCSVLine parses a single line of CSV, trimming whitespace from unquoted fields.
+func parseCSVLine(s string) ([]string, error) {
+	if strings.ContainsAny(s, "\r\n") {
+		return nil, errors.New("expected a single line")
+	}
+	r := csv.NewReader(strings.NewReader(s))
+	r.TrimLeadingSpace = true
+	fields, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i := range fields {
+		if _, col := r.FieldPos(i); col-1 >= len(s) || s[col-1] != '"' {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+	}
+	return fields, nil
+}
+
+// splitList splits a value into a list of strings as described for ResolveStringSlice. You get nil
+// if the value is missing, empty or malformed; malformed values also result in an error.
+func (c *Config) splitList(sep string, elem *string) []string {
+	if elem == nil {
+		return nil
+	}
+	val := strings.TrimSpace(*elem)
+	if val == "" {
+		return nil
+	}
+	if !strings.HasPrefix(val, "[") {
+		parts := strings.Split(val, sep)
+		for i, p := range parts {
+			parts[i] = strings.TrimSpace(p)
+		}
+		return parts
+	}
+	var arr []interface{}
+	if err := json.Unmarshal([]byte(val), &arr); err != nil {
+		c.addError(c.valueError(elem, ErrParse,
+			fmt.Errorf("unrecognized JSON array '%s'%s: %w", *elem, c.origin(elem), err)))
+		return nil
+	}
+	parts := make([]string, len(arr))
+	for i, x := range arr {
+		parts[i] = c.toString(x)
+	}
+	return parts
+}
+
+// ResolveIntSlice is like ResolveStringSlice, but then parses each element of the list as for ResolveInt.
+// If any elements can't be parsed, an error is appended for each of them, and resolution continues with
+// the next value.
+func (c *Config) ResolveIntSlice(sep string, list ...*string) []int {
+	for _, elem := range list {
+		parts := c.splitList(sep, elem)
+		if parts == nil {
+			continue
+		}
+		vals := make([]int, len(parts))
+		ok := true
+		for i, p := range parts {
+			val, err := parseInt(p)
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized numeric value '%s' at index %d of '%s'%s: %w",
+						p, i, *elem, c.origin(elem), err)))
+				ok = false
+			}
+			vals[i] = int(val)
+		}
+		if ok {
+			c.accept(elem)
+			return vals
+		}
+	}
+	c.addError(missingError("int slice"))
+	return nil
+}
+
+// ResolveFloatSlice is like ResolveStringSlice, but then parses each element of the list as for
+// ResolveFloat64. If any elements can't be parsed, an error is appended for each of them, and
+// resolution continues with the next value.
+func (c *Config) ResolveFloatSlice(sep string, list ...*string) []float64 {
+	for _, elem := range list {
+		parts := c.splitList(sep, elem)
+		if parts == nil {
+			continue
+		}
+		vals := make([]float64, len(parts))
+		ok := true
+		for i, p := range parts {
+			val, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized numeric value '%s' at index %d of '%s'%s: %w",
+						p, i, *elem, c.origin(elem), err)))
+				ok = false
+			}
+			vals[i] = val
+		}
+		if ok {
+			c.accept(elem)
+			return vals
+		}
+	}
+	c.addError(missingError("float slice"))
+	return nil
+}
+
+// ResolveStringMap loops through the listed possible values to find a non-missing one,
+// then parses it as a map of strings. Values starting with `{` are parsed as a JSON object,
+// which is also how tables from the config file are represented; otherwise the value is
+// parsed as comma-separated `key=value` pairs, such as `X-Api-Key=abc,Accept=json`.
+// Malformed values result in an error, and resolution continues with the next value.
+// If no values are present, you get nil.
+func (c *Config) ResolveStringMap(list ...*string) map[string]string {
+	for _, elem := range list {
+		if elem == nil {
+			continue
+		}
+		val := strings.TrimSpace(*elem)
+		if val == "" {
+			continue
+		}
+		if strings.HasPrefix(val, "{") {
+			var obj map[string]interface{}
+			if err := json.Unmarshal([]byte(val), &obj); err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized JSON object '%s'%s: %w", *elem, c.origin(elem), err)))
+				continue
+			}
+			m := make(map[string]string, len(obj))
+			for k, x := range obj {
+				m[k] = c.toString(x)
+			}
+			c.accept(elem)
+			return m
+		}
+		m, err := parsePairs(val)
+		if err != nil {
+			c.addError(c.valueError(elem, ErrParse,
+				fmt.Errorf("unrecognized key=value list '%s'%s: %w", *elem, c.origin(elem), err)))
+			continue
+		}
+		c.accept(elem)
+		return m
+	}
+	c.addError(missingError("string map"))
+	return nil
+}
+
+// parsePairs parses a list of comma-separated key=value pairs into a map. Whitespace around keys
+// and values is trimmed.
+func parsePairs(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		i := strings.Index(pair, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("missing = in '%s'", pair)
+		}
+		key := strings.TrimSpace(pair[:i])
+		if key == "" {
+			return nil, fmt.Errorf("missing key in '%s'", pair)
+		}
+		m[key] = strings.TrimSpace(pair[i+1:])
+	}
+	return m, nil
+}
+
+// toString converts an int, bool, float, string or datetime to a string; anything else ends up as empty string.
+// Datetimes are formatted as RFC 3339, local dates and times as ISO 8601 such as `2023-01-01` and
+// `09:00:00`, and arrays and tables (including arrays of tables) as JSON.
+func (c *Config) toString(x interface{}) string {
+	switch v := x.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case toml.LocalDate, toml.LocalTime, toml.LocalDateTime:
+		return v.(fmt.Stringer).String()
+	case []interface{}, []string, []int64, []float64, []bool, map[string]interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			c.addError(fmt.Errorf("can't convert %T to string: %w", v, err))
+			return ""
+		}
+		return string(b)
+	case *toml.Tree:
+		return c.toString(v.ToMap())
+	case []*toml.Tree:
+		maps := make([]interface{}, len(v))
+		for i, t := range v {
+			maps[i] = t.ToMap()
+		}
+		return c.toString(maps)
+	}
+	c.addError(fmt.Errorf("unexpected data type %T", x))
+	return ""
+}
+
+// ResolveInt loops through the listed possible values to find a non-missing one,
+// then parses it and casts it to an integer. If no values are present,
+// you get the zero integer value `0`. Floating point values are rounded down (towards negative
+// infinity), so 2.6 becomes 2 and -2.6 becomes -3. Underscores between digits are accepted, as in
+// TOML and Go, so an environment variable `1_000_000` gives the same result as the file value;
+// underscores at the start or end, or doubled, are errors.
+func (c *Config) ResolveInt(list ...*string) int {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, err := parseInt(*elem)
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized numeric value '%s'%s: %w", *elem, c.origin(elem), err)))
+			} else {
+				c.accept(elem)
+				return int(val)
+			}
+		}
+	}
+	c.addError(missingError("int"))
+	return 0
+}
+
+// ResolveInt64 is like ResolveInt, but returns an int64, so that large values such as byte counts
+// aren't truncated on 32-bit platforms.
+func (c *Config) ResolveInt64(list ...*string) int64 {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, err := parseInt(*elem)
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized numeric value '%s'%s: %w", *elem, c.origin(elem), err)))
+			} else {
+				c.accept(elem)
+				return val
+			}
+		}
+	}
+	c.addError(missingError("int64"))
+	return 0
+}
+
+// ResolveEnumInt is like ResolveInt, but values which aren't in the allowed list result in an error
+// listing the allowed values, and resolution continues with the next value. Values must be written as
+// integers, so `1.9` is an error rather than being rounded down to 1. If no allowed values are present,
+// you get 0.
+func (c *Config) ResolveEnumInt(allowed []int, list ...*string) int {
+	names := make(map[int]string, len(allowed))
+	for _, v := range allowed {
+		names[v] = ""
+	}
+	return c.ResolveEnumIntWithNames(names, list...)
+}
+
+// ResolveEnumIntWithNames is like ResolveEnumInt, but the allowed values are the keys of the names map,
+// and the error for a value which isn't allowed gives their names, e.g. "expected one of: off(0),
+// on(1), auto(2)". The names themselves are also accepted as values, ignoring case, so `mode = "auto"`
+// resolves to 2.
+func (c *Config) ResolveEnumIntWithNames(names map[int]string, list ...*string) int {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, err := strconv.ParseInt(*elem, 0, 64)
+			if err != nil {
+				found := false
+				for k, name := range names {
+					if name != "" && strings.EqualFold(name, strings.TrimSpace(*elem)) {
+						val, found = int64(k), true
+						break
+					}
+				}
+				if !found {
+					c.addError(c.valueError(elem, ErrParse,
+						fmt.Errorf("unrecognized numeric value '%s'%s: %w", *elem, c.origin(elem), err)))
+					continue
+				}
+			}
+			if _, ok := names[int(val)]; ok {
+				return int(val)
+			}
+			c.addError(c.valueError(elem, ErrInvalidValue,
+				fmt.Errorf("value '%s'%s not allowed, expected one of: %s", *elem, c.origin(elem),
+					enumNames(names))))
+		}
+	}
+	c.addError(missingError("enum"))
+	return 0
+}
+
+// enumNames lists the allowed values of an enum in numeric order, with their names if they have them.
+func enumNames(names map[int]string) string {
+	vals := make([]int, 0, len(names))
+	for v := range names {
+		vals = append(vals, v)
+	}
+	sort.Ints(vals)
+	desc := make([]string, len(vals))
+	for i, v := range vals {
+		if names[v] != "" {
+			desc[i] = fmt.Sprintf("%s(%d)", names[v], v)
+		} else {
+			desc[i] = strconv.Itoa(v)
+		}
+	}
+	return strings.Join(desc, ", ")
+}
+
+// parseInt parses an integer as for ResolveInt, accepting base prefixes and rounding floating
+// point values down. Values out of range for an int64, including infinities, are errors, as is NaN.
+func parseInt(s string) (int64, error) {
+	val, err := strconv.ParseInt(s, 0, 64)
+	if err == nil || errors.Is(err, strconv.ErrRange) {
+		return val, err
+	}
+	tv, ferr := strconv.ParseFloat(s, 64)
+	if ferr != nil {
+		return 0, err
+	}
+	tv = math.Floor(tv)
+	if math.IsNaN(tv) || tv < math.MinInt64 || tv >= math.MaxInt64 {
+		return 0, fmt.Errorf("value %s out of range for an integer", s)
+	}
+	return int64(tv), nil
+}
+
+// ResolveFloat64 loops through the listed possible values to find a non-missing one,
+// then parses it and casts it to a float64. If no values are present,
+// you get the zero value. Underscores between digits are accepted, as for ResolveInt.
+func (c *Config) ResolveFloat64(list ...*string) float64 {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, err := strconv.ParseFloat(*elem, 64)
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized numeric value '%s'%s: %w", *elem, c.origin(elem), err)))
+			} else {
+				c.accept(elem)
+				return val
+			}
+		}
+	}
+	c.addError(missingError("float"))
+	return 0.0
+}
+
+// ResolveFloat32 loops through the listed possible values to find a non-missing one,
+// then parses it as a float32. Values out of range for a float32 are treated as errors.
+// If no values are present, you get the zero value.
+func (c *Config) ResolveFloat32(list ...*string) float32 {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, err := strconv.ParseFloat(*elem, 32)
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized numeric value '%s'%s: %w", *elem, c.origin(elem), err)))
+			} else {
+				return float32(val)
+			}
+		}
+	}
+	c.addError(missingError("float"))
+	return 0.0
+}
+
+// ResolveFloatLocale is like ResolveFloat64, but accepts numbers as people write them, such as
+// `"1,234.56"`, ignoring the digit group separators listed in Config.GroupSeparators and using
+// Config.DecimalSeparator as the decimal point. A trailing `%` divides the value by 100, so `"10%"`
+// gives 0.1; unlike ResolvePercent, the result isn't limited to the range 0 to 1. NaN and infinite values
+// such as `"nan"` and `"inf%"` are errors.
+func (c *Config) ResolveFloatLocale(list ...*string) float64 {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, err := c.parseFloatLocale(*elem)
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized numeric value '%s'%s: %w", *elem, c.origin(elem), err)))
+			} else {
+				return val
+			}
+		}
+	}
+	c.addError(missingError("float"))
+	return 0.0
+}
+
+// parseFloatLocale parses a float as for ResolveFloatLocale.
+func (c *Config) parseFloatLocale(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	pct := strings.HasSuffix(s, "%")
+	if pct {
+		s = strings.TrimSpace(strings.TrimSuffix(s, "%"))
+	}
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(c.GroupSeparators, r) {
+			return -1
+		}
+		return r
+	}, s)
+	if c.DecimalSeparator != "" && c.DecimalSeparator != "." {
+		s = strings.Replace(s, c.DecimalSeparator, ".", 1)
+	}
+	val, err := parseFinite(s)
+	if pct {
+		val /= 100
+	}
+	return val, err
+}
+
+// parseFinite parses a float, rejecting NaN and infinities, which strconv.ParseFloat accepts as "nan" and "inf".
+func parseFinite(s string) (float64, error) {
+	val, err := strconv.ParseFloat(s, 64)
+	if err == nil && (math.IsNaN(val) || math.IsInf(val, 0)) {
+		return 0, fmt.Errorf("value %s is not a finite number", s)
+	}
+	return val, err
+}
+
+// ResolvePercent loops through the listed possible values to find a non-missing one,
+// then parses it as a fraction, either a percentage such as `"75%"` or a bare ratio such as
+// `"0.75"`, both of which give 0.75. Values outside the range 0 to 1 are treated as errors,
+// and resolution continues with the next value. If no values are present, you get zero.
+func (c *Config) ResolvePercent(list ...*string) float64 {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			s := strings.TrimSpace(*elem)
+			pct := strings.HasSuffix(s, "%")
+			if pct {
+				s = strings.TrimSpace(strings.TrimSuffix(s, "%"))
+			}
+			val, err := parseFinite(s)
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized percentage value '%s'%s: %w", *elem, c.origin(elem), err)))
+				continue
+			}
+			if pct {
+				val /= 100
+			}
+			if val < 0 || val > 1 {
+				c.addError(c.valueError(elem, ErrInvalidValue,
+					fmt.Errorf("percentage value '%s'%s is outside the range 0%% to 100%%", *elem, c.origin(elem))))
+				continue
+			}
+			return val
+		}
+	}
+	c.addError(missingError("percent"))
+	return 0.0
+}
+
+// ResolveBigInt loops through the listed possible values to find a non-missing one,
+// then parses it as an arbitrary-precision integer, accepting the same base prefixes as ResolveInt.
+// If no values are present, you get zero.
+func (c *Config) ResolveBigInt(list ...*string) *big.Int {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, ok := new(big.Int).SetString(*elem, 0)
+			if !ok {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized integer value '%s'%s", *elem, c.origin(elem))))
+			} else {
+				return val
+			}
+		}
+	}
+	c.addError(missingError("big int"))
+	return new(big.Int)
+}
+
+// ResolveRat loops through the listed possible values to find a non-missing one,
+// then parses it as an exact rational number, either a fraction such as `"22/7"` or a
+// decimal such as `"3.14"`. If no values are present, you get zero.
+func (c *Config) ResolveRat(list ...*string) *big.Rat {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, ok := new(big.Rat).SetString(*elem)
+			if !ok {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized rational value '%s'%s", *elem, c.origin(elem))))
+			} else {
+				return val
+			}
+		}
+	}
+	c.addError(missingError("rational"))
+	return new(big.Rat)
+}
+
+// ResolveDate loops through the listed possible values to find a non-missing one,
+// then parses it as a local date without a time zone, such as `2023-01-01`.
+// If no values are present, you get the zero date.
+func (c *Config) ResolveDate(list ...*string) toml.LocalDate {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, err := toml.ParseLocalDate(strings.TrimSpace(*elem))
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized date value '%s'%s: %w", *elem, c.origin(elem), err)))
+			} else {
+				return val
+			}
+		}
+	}
+	c.addError(missingError("date"))
+	return toml.LocalDate{}
+}
+
+// ResolveTimeOfDay loops through the listed possible values to find a non-missing one,
+// then parses it as a local time of day without a time zone, such as `09:00:00`.
+// If no values are present, you get midnight.
+func (c *Config) ResolveTimeOfDay(list ...*string) toml.LocalTime {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, err := toml.ParseLocalTime(strings.TrimSpace(*elem))
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized time value '%s'%s: %w", *elem, c.origin(elem), err)))
+			} else {
+				return val
+			}
+		}
+	}
+	c.addError(missingError("time"))
+	return toml.LocalTime{}
+}
+
+// ResolveLocalDateTime loops through the listed possible values to find a non-missing one,
+// then parses it as a local date and time without a time zone, such as `2023-01-02T09:30:00`.
+// As in TOML, a space may be used instead of the `T`. If no values are present, you get the zero
+// date and time.
+func (c *Config) ResolveLocalDateTime(list ...*string) toml.LocalDateTime {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			s := strings.TrimSpace(*elem)
+			if len(s) > 10 && s[10] == ' ' {
+				s = s[:10] + "T" + s[11:]
+			}
+			val, err := toml.ParseLocalDateTime(s)
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized date and time value '%s'%s: %w", *elem, c.origin(elem), err)))
+			} else {
+				return val
+			}
+		}
+	}
+	c.addError(missingError("date and time"))
+	return toml.LocalDateTime{}
+}
+
+// ResolveRGBA loops through the listed possible values to find a non-missing one,
+// then parses it as a hex color in the form `#RGB`, `#RRGGBB` or `#RRGGBBAA`. Colors without
+// an alpha component are opaque. If no values are present, you get transparent black.
+func (c *Config) ResolveRGBA(list ...*string) color.RGBA {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			col, err := parseHexColor(strings.TrimSpace(*elem))
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized color value '%s'%s: %w", *elem, c.origin(elem), err)))
+			} else {
+				return col
+			}
+		}
+	}
+	c.addError(missingError("color"))
+	return color.RGBA{}
+}
+
+// parseHexColor parses a color in the form #RGB, #RRGGBB or #RRGGBBAA.
+func parseHexColor(s string) (color.RGBA, error) {
+	if !strings.HasPrefix(s, "#") {
+		return color.RGBA{}, fmt.Errorf("color must start with #")
+	}
+	hex := s[1:]
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.RGBA{}, fmt.Errorf("color must have 3, 6 or 8 hex digits")
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	return color.RGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// ResolveDuration loops through the listed possible values to find a non-missing one,
+// then parses it as a duration such as `"1m30s"` using time.ParseDuration. If no values are
+// present, you get the zero duration.
+func (c *Config) ResolveDuration(list ...*string) time.Duration {
+	return c.ResolveDurationRange(math.MinInt64, math.MaxInt64, list...)
+}
+
+// ResolveDurationRange is like ResolveDuration, but values outside the range min to max inclusive
+// are treated as errors, and resolution continues with the next value. A max of zero means there
+// is no upper limit, so ResolveDurationRange(0, 0, ...) simply rejects negative durations.
+func (c *Config) ResolveDurationRange(min, max time.Duration, list ...*string) time.Duration {
+	if max == 0 {
+		max = math.MaxInt64
+	}
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, err := time.ParseDuration(*elem)
+			switch {
+			case err != nil:
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized duration value '%s'%s: %w", *elem, c.origin(elem), err)))
+			case val < min:
+				c.addError(c.valueError(elem, ErrInvalidValue,
+					fmt.Errorf("duration value '%s'%s is less than minimum %v", *elem, c.origin(elem), min)))
+			case val > max:
+				c.addError(c.valueError(elem, ErrInvalidValue,
+					fmt.Errorf("duration value '%s'%s is greater than maximum %v", *elem, c.origin(elem), max)))
+			default:
+				c.accept(elem)
+				return val
+			}
+		}
+	}
+	c.addError(missingError("duration"))
+	return 0
+}
+
+// ResolveFileMode loops through the listed possible values to find a non-missing one, then parses it
+// as octal file permissions such as `"0644"`, `"0o755"` or `"600"`. Integers from the config file, such
+// as `perm = 0o755`, are used as they are, since TOML has already parsed them. That means `perm = 644`
+// is the decimal number 644, octal 01204, which is almost certainly a mistake, so integers written in
+// the file as three or four decimal digits which are all octal digits, such as 400, 644 or 1777, result
+// in an error suggesting `0o644` or `"0644"` instead. Values set with Set are used as they are. Values
+// which aren't valid octal or are greater than 07777 result in an error, and resolution continues with
+// the next value. If no values are present, you get 0.
+func (c *Config) ResolveFileMode(list ...*string) os.FileMode {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, err := c.parseFileMode(elem)
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized file mode value '%s'%s: %w", *elem, c.origin(elem), err)))
+			} else {
+				c.accept(elem)
+				return val
+			}
+		}
+	}
+	c.addError(missingError("file mode"))
+	return 0
+}
+
+// parseFileMode parses a file mode for ResolveFileMode.
+func (c *Config) parseFileMode(elem *string) (os.FileMode, error) {
+	var val uint64
+	fv, _ := c.fileOrigin(elem)
+	if n, ok := fv.value.(int64); ok {
+		if n < 0 {
+			return 0, fmt.Errorf("file mode can't be negative")
+		}
+		if d := strconv.FormatInt(n, 10); fv.decimal && (len(d) == 3 || len(d) == 4) && strings.Trim(d, "01234567") == "" {
+			if o, _ := strconv.ParseInt(d, 8, 64); o != n {
+				return 0, fmt.Errorf("integer file mode %d is %#o; write it as 0o%s or \"0%s\" if you meant octal", n, n, d, d)
+			}
+		}
+		val = uint64(n)
+	} else {
+		s := strings.TrimSpace(*elem)
+		if len(s) > 1 && s[0] == '0' && (s[1] == 'o' || s[1] == 'O') {
+			s = s[2:]
+		}
+		var err error
+		if val, err = strconv.ParseUint(s, 8, 32); err != nil {
+			return 0, err
+		}
+	}
+	if val > 07777 {
+		return 0, fmt.Errorf("file mode is greater than 07777")
+	}
+	return os.FileMode(val), nil
+}
+
+// ResolveRegexp loops through the listed possible values to find a non-missing one, then compiles it
+// as a regular expression using regexp.Compile, so that bad patterns are caught when the config is
+// loaded rather than when they're first used. Patterns which don't compile result in an error including
+// the pattern, and resolution continues with the next value. If no values are present, you get nil.
+func (c *Config) ResolveRegexp(list ...*string) *regexp.Regexp {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			re, err := regexp.Compile(*elem)
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("invalid regular expression '%s'%s: %w", *elem, c.origin(elem), err)))
+			} else {
+				return re
+			}
+		}
+	}
+	c.addError(missingError("regular expression"))
+	return nil
+}
+
+// ResolveTimeZone loops through the listed possible values to find a non-missing one,
+// then loads it as a time zone such as `America/New_York` using time.LoadLocation. Unknown
+// zone names result in an error, and resolution continues with the next value. If no values
+// are present, you get UTC.
+func (c *Config) ResolveTimeZone(list ...*string) *time.Location {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			loc, err := time.LoadLocation(strings.TrimSpace(*elem))
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized time zone value '%s'%s: %w", *elem, c.origin(elem), err)))
+			} else {
+				return loc
+			}
+		}
+	}
+	c.addError(missingError("time zone"))
+	return time.UTC
+}
+
+// ResolvePath loops through the listed possible values to find a non-missing one, and returns it as a
+// file path. If the value came from the config file via FromFile and is a relative path, it's resolved
+// against the directory of the file which set it, so that `cert_file = "certs/server.pem"` means the same
+// thing whatever the current directory. Other values, such as those from flags or the environment, are
+// returned as they are, as are absolute paths. Included files and files merged by LoadMergeGlob each
+// have their paths resolved against their own directory. Files loaded with LoadFS, LoadReader or LoadURL
+// have no directory, so their relative paths are left unchanged. If no values are present, you get "".
+func (c *Config) ResolvePath(list ...*string) string {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			p := *elem
+			if fv, ok := c.fileOrigin(elem); ok && !filepath.IsAbs(p) && fv.dir != "" {
+				p = filepath.Join(fv.dir, p)
+			}
+			return p
+		}
+	}
+	c.addError(missingError("path"))
+	return ""
+}
+
+// ResolveHostPort loops through the listed possible values to find a non-missing one,
+// then splits it into host and port using net.SplitHostPort, so `":8080"`, `"0.0.0.0:9000"` and
+// `"[::1]:443"` are all accepted. The host is empty for the bare `":port"` form, and IPv6 hosts
+// are returned without brackets. If no values are present, you get an empty host and port 0.
+func (c *Config) ResolveHostPort(list ...*string) (host string, port int) {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			h, p, err := net.SplitHostPort(strings.TrimSpace(*elem))
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized host:port value '%s'%s: %w", *elem, c.origin(elem), err)))
+				continue
+			}
+			n, err := strconv.ParseUint(p, 10, 16)
+			if err != nil {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("invalid port in host:port value '%s'%s", *elem, c.origin(elem))))
+				continue
+			}
+			return h, int(n)
+		}
+	}
+	c.addError(missingError("host:port"))
+	return "", 0
+}
+
+// ResolvePair loops through the listed possible values to find a non-missing one, then splits it on
+// sep into exactly two floating point numbers, so that `"40.7128,-74.0060"` with sep "," gives 40.7128
+// and -74.006. Whitespace around the numbers is ignored. Values with the wrong number of parts or
+// non-numeric parts result in an error, and resolution continues with the next value. If no values
+// are present, you get 0, 0.
+func (c *Config) ResolvePair(sep string, list ...*string) (a float64, b float64) {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			if a, b, ok := c.parsePair(elem, sep); ok {
+				return a, b
+			}
+		}
+	}
+	c.addError(missingError("pair"))
+	return 0, 0
+}
+
+// parsePair parses a value as two floating point numbers separated by sep, appending an error if it
+// can't.
+func (c *Config) parsePair(elem *string, sep string) (float64, float64, bool) {
+	parts := strings.Split(*elem, sep)
+	if len(parts) != 2 {
+		c.addError(c.valueError(elem, ErrParse,
+			fmt.Errorf("unrecognized pair value '%s'%s: expected 2 numbers separated by '%s', found %d parts",
+				*elem, c.origin(elem), sep, len(parts))))
+		return 0, 0, false
+	}
+	var xs [2]float64
+	for i, p := range parts {
+		x, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			c.addError(c.valueError(elem, ErrParse,
+				fmt.Errorf("unrecognized pair value '%s'%s: %w", *elem, c.origin(elem), err)))
+			return 0, 0, false
+		}
+		xs[i] = x
+	}
+	return xs[0], xs[1], true
+}
+
+// ResolveLatLong is like ResolvePair with sep ",", but also checks that the values are a valid latitude
+// and longitude, between -90 and 90 and between -180 and 180 respectively. Out of range values result
+// in an error, and resolution continues with the next value.
+func (c *Config) ResolveLatLong(list ...*string) (lat float64, long float64) {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			lat, long, ok := c.parsePair(elem, ",")
+			if !ok {
+				continue
+			}
+			if lat < -90 || lat > 90 || long < -180 || long > 180 {
+				c.addError(c.valueError(elem, ErrInvalidValue,
+					fmt.Errorf("latitude,longitude value '%s'%s out of range", *elem, c.origin(elem))))
+				continue
+			}
+			return lat, long
+		}
+	}
+	c.addError(missingError("latitude,longitude"))
+	return 0, 0
+}
+
+// UseCommonBools extends TrueStrings and FalseStrings with the commonly used alternatives
+// `yes`/`no`, `y`/`n`, `on`/`off`, `enabled`/`disabled` and `1`/`0`, so that ResolveBool accepts
+// the values users are likely to write. Values already in the lists aren't added again, so it's
+// safe to call more than once.
+func (c *Config) UseCommonBools() {
+	c.TrueStrings = appendMissing(c.TrueStrings, "yes", "y", "on", "enabled", "1")
+	c.FalseStrings = appendMissing(c.FalseStrings, "no", "n", "off", "disabled", "0")
+}
+
+// appendMissing appends the values which aren't already in the list, ignoring case.
+func appendMissing(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, x := range list {
+			if strings.EqualFold(x, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// stringToBool interprets a string as a bool, given the lists of TrueStrings and FalseStrings.
+// If there's a match, you get the decoded boolean, and ok = true.
+// Values which don't match either list result in ok = false.
+func (c *Config) stringToBool(bs string) (value bool, ok bool) {
+	tbs := strings.TrimSpace(bs)
+	for _, ts := range c.TrueStrings {
+		if strings.EqualFold(tbs, ts) {
+			return true, true
+		}
+	}
+	for _, ts := range c.FalseStrings {
+		if strings.EqualFold(tbs, ts) {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// ResolveBool loops through the listed possible values to find a non-missing one,
+// then parses it and casts it to a boolean. Unrecognized values result in an error,
+// and resolution continues with the next value. If no values are present,
+// you get the zero boolean value `false`.
+func (c *Config) ResolveBool(list ...*string) bool {
+	b, ok := c.resolveBool(list)
+	if !ok {
+		c.addError(missingError("bool"))
+	}
+	return b
+}
+
+// ResolveBoolPtr is like ResolveBool, but returns nil if no values are present, so that you can
+// distinguish a setting which is unset from one which is explicitly false. Missing values aren't
+// treated as an error, so there's no need for a default; unrecognized values are still errors,
+// and if none of the values is recognized you get nil.
+func (c *Config) ResolveBoolPtr(list ...*string) *bool {
+	if b, ok := c.resolveBool(list); ok {
+		return &b
+	}
+	return nil
+}
+
+// resolveBool finds the first recognized bool value in the list, with ok = false if there isn't one.
+func (c *Config) resolveBool(list []*string) (value bool, ok bool) {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			b, ok := c.stringToBool(*elem)
+			if !ok {
+				c.addError(c.valueError(elem, ErrParse,
+					fmt.Errorf("unrecognized bool value %s%s", *elem, c.origin(elem))))
+			} else {
+				c.accept(elem)
+				return b, true
+			}
+		}
+	}
+	return false, false
+}
+
+// Explain describes how a list of possible values would be resolved, one line per value, saying which
+// values are missing or empty and which one is selected. Values from the config file are annotated with
+// their key. It's intended as a debugging aid, and never appends to Config.Errors.
+//
+// The value selected is the first which is non-missing and non-empty, as used by ResolveInt, ResolveBool
+// and so on. ResolveString also accepts empty values, so any empty value before the selected one is noted.
+// For structured output with named sources, see ExplainSources.
+func (c *Config) Explain(list ...*string) string {
+	var sb strings.Builder
+	selected := false
+	for i, elem := range list {
+		fmt.Fprintf(&sb, "%d: ", i+1)
+		switch {
+		case elem == nil:
+			sb.WriteString("missing")
+		case *elem == "":
+			sb.WriteString("empty" + c.origin(elem))
+			if !selected && !c.TreatEmptyAsUnset {
+				sb.WriteString(", but used by ResolveString")
+			}
+		default:
+			fmt.Fprintf(&sb, "%q%s", *elem, c.origin(elem))
+			if !selected {
+				sb.WriteString(" <- selected")
+				selected = true
+			} else {
+				sb.WriteString(", ignored")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	if !selected {
+		sb.WriteString("no value selected\n")
+	}
+	return sb.String()
+}
+
+// --- named value resolution
+
+// secretWords are the parts of setting names which make debugResolve redact the value.
+var secretWords = []string{"password", "passwd", "secret", "token", "credential", "private", "apikey", "api_key"}
+
+// debugResolve prepares to print the value which the resolver selects from the list for the named
+// setting, and its source, if EnvDebug is set. The returned function does the printing, and should be
+// deferred until the resolver has finished.
+func (c *Config) debugResolve(name string, list []*string) func() {
+	if !c.EnvDebug {
+		return func() {}
+	}
+	r := c.root()
+	r.mu.Lock()
+	r.accepted = nil
+	r.mu.Unlock()
+	return func() {
+		w := r.debugOut
+		if w == nil {
+			w = os.Stderr
+		}
+		r.mu.Lock()
+		elem := r.accepted
+		r.accepted = nil
+		env, isEnv := r.envOrigins[elem]
+		fv, isFile := r.origins[elem]
+		r.mu.Unlock()
+		i := -1
+		for j, x := range list {
+			if x == elem {
+				i = j
+				break
+			}
+		}
+		if elem == nil || i < 0 {
+			fmt.Fprintf(w, "resolved %s: no value\n", name)
+			return
+		}
+		source := fmt.Sprintf("value %d", i+1)
+		if isEnv {
+			source = env
+		} else if isFile {
+			source = fmt.Sprintf("file key '%s'", fv.key)
+		}
+		value := strconv.Quote(*elem)
+		lname := strings.ToLower(name)
+		for _, word := range secretWords {
+			if strings.Contains(lname, word) {
+				value = Redacted
+				break
+			}
+		}
+		fmt.Fprintf(w, "resolved %s from %s = %s\n", name, source, value)
+	}
+}
+
+// accept records the value a resolver has selected, for debugResolve.
+func (c *Config) accept(elem *string) {
+	if c.EnvDebug {
+		r := c.root()
+		r.mu.Lock()
+		r.accepted = elem
+		r.mu.Unlock()
+	}
+}
+
+// tagErrors makes errors added to the Config say which named setting was being resolved, until the
+// returned function is called. The errors are wrapped before they're logged or passed to OnError.
+func (c *Config) tagErrors(name string) func() {
+	r := c.root()
+	r.mu.Lock()
+	prev := r.resolving
+	r.resolving = name
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		r.resolving = prev
+		r.mu.Unlock()
+	}
+}
+
+// ResolveStringNamed is like ResolveString, but any errors say which named setting was being resolved,
+// e.g. "resolving 'database.host': missing default string value".
+func (c *Config) ResolveStringNamed(name string, list ...*string) string {
+	defer c.debugResolve(name, list)()
+	defer c.tagErrors(name)()
+	return c.ResolveString(list...)
+}
+
+// ResolveIntNamed is like ResolveInt, but any errors say which named setting was being resolved.
+func (c *Config) ResolveIntNamed(name string, list ...*string) int {
+	defer c.debugResolve(name, list)()
+	defer c.tagErrors(name)()
+	return c.ResolveInt(list...)
+}
+
+// ResolveFloat64Named is like ResolveFloat64, but any errors say which named setting was being resolved.
+func (c *Config) ResolveFloat64Named(name string, list ...*string) float64 {
+	defer c.debugResolve(name, list)()
+	defer c.tagErrors(name)()
+	return c.ResolveFloat64(list...)
+}
+
+// ResolveBoolNamed is like ResolveBool, but any errors say which named setting was being resolved.
+func (c *Config) ResolveBoolNamed(name string, list ...*string) bool {
+	defer c.debugResolve(name, list)()
+	defer c.tagErrors(name)()
+	return c.ResolveBool(list...)
+}
+
+// ResolveDurationNamed is like ResolveDuration, but any errors say which named setting was being resolved.
+func (c *Config) ResolveDurationNamed(name string, list ...*string) time.Duration {
+	defer c.debugResolve(name, list)()
+	defer c.tagErrors(name)()
+	return c.ResolveDuration(list...)
+}
+
+// --- panicking value resolution
+
+// mustResolve panics if any errors were added to the Config since there were n of them,
+// listing all of the new retained errors in the panic message.
+func (c *Config) mustResolve(n int) {
+	errs, dropped := c.errorsSince(n)
+	if len(errs) == 0 && dropped == 0 {
+		return
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	if dropped > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d more errors dropped", dropped))
+	}
+	panic(fmt.Sprintf("config resolution failed: %s", strings.Join(msgs, "; ")))
+}
+
+// mustResolveValue is like mustResolve, but only panics if one of the new errors is ErrMissingValue,
+// meaning that no value was resolved. The panic message still lists all of the new errors, so that it
+// explains why any values which were present were skipped.
+func (c *Config) mustResolveValue(n int) {
+	errs, _ := c.errorsSince(n)
+	for _, err := range errs {
+		if errors.Is(err, ErrMissingValue) {
+			c.mustResolve(n)
+		}
+	}
+}
+
+// MustResolveString is like ResolveString, but panics if any errors occur during resolution.
+func (c *Config) MustResolveString(list ...*string) string {
+	defer c.mustResolve(c.errorCount())
+	return c.ResolveString(list...)
+}
+
+// MustResolveInt is like ResolveInt, but panics if any errors occur during resolution.
+func (c *Config) MustResolveInt(list ...*string) int {
+	defer c.mustResolve(c.errorCount())
+	return c.ResolveInt(list...)
+}
+
+// MustResolveFloat64 is like ResolveFloat64, but panics if any errors occur during resolution.
+func (c *Config) MustResolveFloat64(list ...*string) float64 {
+	defer c.mustResolve(c.errorCount())
+	return c.ResolveFloat64(list...)
+}
+
+// MustResolveBool is like ResolveBool, but panics if any errors occur during resolution.
+func (c *Config) MustResolveBool(list ...*string) bool {
+	defer c.mustResolve(c.errorCount())
+	return c.ResolveBool(list...)
+}
+
+// MustResolveStringNamed is like MustResolveString, but the panic message says which named setting
+// couldn't be resolved, e.g. "config resolution failed: resolving 'database.host': missing default
+// string value". It's intended for settings with no sensible default, which should stop the
+// application at startup if they aren't configured, so unlike MustResolveString it only panics if no
+// value could be resolved. Values skipped because they couldn't be parsed are appended to Config.Errors
+// as usual, and are listed in the panic message if it does panic.
+func (c *Config) MustResolveStringNamed(name string, list ...*string) string {
+	defer c.debugResolve(name, list)()
+	defer c.mustResolveValue(c.errorCount())
+	defer c.tagErrors(name)()
+	return c.ResolveString(list...)
+}
+
+// MustResolveIntNamed is like MustResolveInt, but the panic message says which named setting
+// couldn't be resolved. As for MustResolveStringNamed, it only panics if no value could be resolved.
+func (c *Config) MustResolveIntNamed(name string, list ...*string) int {
+	defer c.debugResolve(name, list)()
+	defer c.mustResolveValue(c.errorCount())
+	defer c.tagErrors(name)()
+	return c.ResolveInt(list...)
+}
+
+// MustResolveFloat64Named is like MustResolveFloat64, but the panic message says which named setting
+// couldn't be resolved. As for MustResolveStringNamed, it only panics if no value could be resolved.
+func (c *Config) MustResolveFloat64Named(name string, list ...*string) float64 {
+	defer c.debugResolve(name, list)()
+	defer c.mustResolveValue(c.errorCount())
+	defer c.tagErrors(name)()
+	return c.ResolveFloat64(list...)
+}
+
+// MustResolveBoolNamed is like MustResolveBool, but the panic message says which named setting
+// couldn't be resolved. As for MustResolveStringNamed, it only panics if no value could be resolved.
+func (c *Config) MustResolveBoolNamed(name string, list ...*string) bool {
+	defer c.debugResolve(name, list)()
+	defer c.mustResolveValue(c.errorCount())
+	defer c.tagErrors(name)()
+	return c.ResolveBool(list...)
+}
+
+// MustResolveDurationNamed is like ResolveDuration, but panics if no value could be resolved, with a
+// message saying which named setting couldn't be resolved, as for MustResolveStringNamed.
+func (c *Config) MustResolveDurationNamed(name string, list ...*string) time.Duration {
+	defer c.debugResolve(name, list)()
+	defer c.mustResolveValue(c.errorCount())
+	defer c.tagErrors(name)()
+	return c.ResolveDuration(list...)
+}
+
+// FromEnvBase64 looks for a base64-encoded value in an environment variable with the specified name,
+// and decodes it. Both standard and URL-safe encodings are accepted, with or without padding. If the
+// value can't be decoded, an error is appended to Config.Errors and you get nil.
+func (c *Config) FromEnvBase64(key string) *string {
+	x, ok := c.lookupEnv(key)
+	if !ok {
+		return nil
+	}
+	x = strings.TrimSpace(x)
+	if x == "" && c.TreatEmptyEnvAsUnset {
+		return nil
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding,
+		base64.RawStdEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(x); err == nil {
+			d := string(b)
+			return &d
+		}
+	}
+	c.addError(&ValueError{Source: "environment variable " + key,
+		Err: fmt.Errorf("environment variable %s isn't valid base64", key), kind: ErrParse})
+	return nil
+}
+
+// FromEnvJSON decodes the JSON value of an environment variable into out, which must be a pointer, so that
+// structured values such as `ENDPOINTS='["a","b"]'` can be supplied through the environment. If the
+// variable isn't set, out is left unchanged and nil is returned. If the value can't be decoded, the error
+// is returned and also appended to Config.Errors; it doesn't include the value, which may be secret.
+func (c *Config) FromEnvJSON(key string, out interface{}) error {
+	x := c.FromEnv(key)
+	if x == nil {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(*x), out); err != nil {
+		ve := &ValueError{Source: "environment variable " + key,
+			Err: fmt.Errorf("environment variable %s isn't valid JSON for %T: %w", key, out, err), kind: ErrParse}
+		c.addError(ve)
+		return ve
+	}
+	return nil
+}
+
+// RequireEnv checks that each of the named environment variables is set to a non-empty value,
+// returning one error per missing variable, or nil if they are all present. The errors are
+// also appended to Config.Errors.
+func (c *Config) RequireEnv(keys ...string) []error {
+	var errs []error
+	for _, key := range keys {
+		if v, ok := c.lookupEnv(key); !ok || v == "" {
+			err := &ValueError{Source: "environment variable " + key,
+				Err: fmt.Errorf("required environment variable %s not set", key), kind: ErrMissingValue}
+			c.addError(err)
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// lookupEnv looks up an environment variable using Config.LookupEnv, or os.LookupEnv if that's not set.
+func (c *Config) lookupEnv(key string) (string, bool) {
+	if c.LookupEnv != nil {
+		return c.LookupEnv(key)
+	}
+	return os.LookupEnv(key)
+}
+
+// FromEnv looks for a value in an environment variable with the specified name. A variable which is set
+// to the empty string counts as present, unless Config.TreatEmptyEnvAsUnset is set.
+func (c *Config) FromEnv(key string) *string {
+	x, ok := c.lookupEnv(key)
+	if ok {
+		if c.TrimValues {
+			x = strings.TrimSpace(x)
+		}
+		if x == "" && c.TreatEmptyEnvAsUnset {
+			return nil
+		}
+		if c.EnvDebug {
+			r := c.root()
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if p := r.envValues[key]; p != nil && *p == x {
+				return p
+			}
+			if r.envValues == nil {
+				r.envValues = make(map[string]*string)
+				r.envOrigins = make(map[*string]string)
+			}
+			delete(r.envOrigins, r.envValues[key])
+			r.envValues[key] = &x
+			r.envOrigins[&x] = key
+		}
+		return &x
+	}
+	c.log().Debugf("environment variable %s not set", key)
+	return nil
+}
+
+// FromEnvAlias looks for a value in the environment variable named current, then in each of the
+// deprecated names in turn. If a deprecated name is used, a warning naming both variables is
+// appended to Config.Warnings, so that renamed variables keep working during a migration.
+func (c *Config) FromEnvAlias(current string, deprecated ...string) *string {
+	if v := c.FromEnv(current); v != nil {
+		return v
+	}
+	for _, old := range deprecated {
+		if v := c.FromEnv(old); v != nil {
+			c.addWarning(fmt.Errorf("environment variable %s is deprecated, use %s instead", old, current))
+			return v
+		}
+	}
+	return nil
+}
+
+// Source is an external source of configuration values, such as a secrets manager.
+// Lookup returns nil if the key has no value.
+type Source interface {
+	Lookup(key string) (*string, error)
+}
+
+// FromSource looks for a value in an external Source. Any error from the Source is appended
+// to Config.Errors, and you get nil.
+func (c *Config) FromSource(s Source, key string) *string {
+	v, err := s.Lookup(key)
+	if err != nil {
+		c.addError(fmt.Errorf("couldn't look up '%s': %w", key, err))
+		return nil
+	}
+	return v
+}
+
+// UseEnvironmentFromEnv sets Config.Environment from the named environment variable, such as `APP_ENV`,
+// or to Config.DefaultEnvironment if the variable is unset or empty.
+func (c *Config) UseEnvironmentFromEnv(envVar string) {
+	env, _ := c.lookupEnv(envVar)
+	if env == "" {
+		env = c.DefaultEnvironment
+	}
+	c.Environment = env
+}
+
+// Alias registers oldKey as the previous name of newKey, so that if the file has no value for newKey,
+// lookups of newKey by FromFile and friends fall back to oldKey. When the old key is used, a deprecation
+// warning is appended to Config.Warnings. Several old keys can be registered for the same new key, and
+// are checked in the order registered. Keys are relative to the Config, so aliases registered on a parent
+// don't apply to sub-configs.
+func (c *Config) Alias(oldKey, newKey string) {
+	if c.aliases == nil {
+		c.aliases = make(map[string][]string)
+	}
+	c.aliases[newKey] = append(c.aliases[newKey], oldKey)
+}
+
+// lookup finds the value for a key in the config file, falling back to any old keys registered with Alias.
+func (c *Config) lookup(key string) (string, interface{}, bool) {
+	if c.fileData == nil {
+		return "", nil, false
+	}
+	if fkey, v, ok := c.lookupEnvironment(key); ok {
+		return fkey, v, true
+	}
+	for _, old := range c.aliases[key] {
+		if fkey, v, ok := c.lookupEnvironment(old); ok {
+			c.addWarning(fmt.Errorf("file key '%s' is deprecated, use '%s' instead", fkey, key))
+			return fkey, v, true
+		}
+	}
+	return "", nil, false
+}
+
+// lookupEnvironment finds the value for a key in the config file. If Config.Environment is set, the key is
+// looked up in that section first, then at the top level. It returns the full key found, and the value.
+func (c *Config) lookupEnvironment(key string) (string, interface{}, bool) {
+	if c.Environment != "" {
+		ekey := c.Environment + "." + key
+		if fkey, v, ok := c.lookupKey(ekey); ok {
+			return fkey, v, true
+		}
+	}
+	return c.lookupKey(key)
+}
+
+// lookupKey finds the value for a single dotted key in the config file, ignoring case if
+// Config.CaseInsensitiveKeys is set.
+func (c *Config) lookupKey(key string) (string, interface{}, bool) {
+	if c.fileData.Has(key) {
+		return key, c.fileData.Get(key), true
+	}
+	if !c.CaseInsensitiveKeys {
+		return "", nil, false
+	}
+	tree := c.fileData
+	var found []string
+	var v interface{}
+	for i, part := range strings.Split(key, ".") {
+		if i > 0 {
+			var ok bool
+			if tree, ok = v.(*toml.Tree); !ok {
+				return "", nil, false
+			}
+		}
+		k := c.foldKey(tree, strings.Join(append(found, part), "."), part)
+		if k == "" {
+			return "", nil, false
+		}
+		found = append(found, k)
+		v = tree.GetPath([]string{k})
+	}
+	return strings.Join(found, "."), v, true
+}
+
+// foldKey returns the key in the tree which matches name, preferring an exact match, then the first
+// key in sorted order which matches ignoring case, warning about the ambiguity if there are several.
+// Each ambiguous key is only warned about once for the loaded data.
+// It returns an empty string if there's no match. The full dotted key is used in the warning.
+func (c *Config) foldKey(tree *toml.Tree, full string, name string) string {
+	if tree.HasPath([]string{name}) {
+		return name
+	}
+	var matches []string
+	for _, k := range tree.Keys() {
+		if strings.EqualFold(k, name) {
+			matches = append(matches, k)
+		}
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+	sort.Strings(matches)
+	if len(matches) > 1 && c.firstWarning(c.keyPrefix+full) {
+		c.addWarning(fmt.Errorf("file key '%s' is ambiguous, matching %s; using '%s'", full,
+			strings.Join(matches, ", "), matches[0]))
+	}
+	return matches[0]
+}
+
+// firstWarning reports whether the ambiguous key hasn't been warned about yet, and records that it has.
+func (c *Config) firstWarning(key string) bool {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.warnedKeys[key] {
+		return false
+	}
+	if r.warnedKeys == nil {
+		r.warnedKeys = make(map[string]bool)
+	}
+	r.warnedKeys[key] = true
+	return true
+}
+
+// FromFile obtains a configuration value from the TOML config file, given a string key.
+// If Config.Environment is set, a value in that section of the file takes precedence, so that
+// with Environment "production", FromFile("port") checks `production.port` before `port`.
+// Repeated lookups of a key return the same pointer while its value is unchanged, and once the
+// config is loaded, FromFile and the resolvers can be used from several goroutines at once.
+func (c *Config) FromFile(key string) *string {
+	fkey, v, ok := c.lookup(key)
+	if !ok {
+		c.log().Debugf("file key '%s' not found", key)
+		return nil
+	}
+	x := c.toString(v)
+	if c.TrimValues {
+		x = strings.TrimSpace(x)
+	}
+	r := c.root()
+	full := c.keyPrefix + fkey
+	ki := r.keyInfo[full]
+	fv := fileValue{key: fkey, value: v, dir: ki.dir, decimal: ki.decimal}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.fileValues[full]
+	if p == nil || *p != x {
+		if r.fileValues == nil {
+			r.fileValues = make(map[string]*string)
+			r.origins = make(map[*string]fileValue)
+		}
+		delete(r.origins, p)
+		p = &x
+		r.fileValues[full] = p
+	}
+	r.origins[p] = fv
+	return p
+}
+
+// FromFileRequired is like FromFile, but if the key isn't in the config file, an error is appended to
+// Config.Errors as well as nil being returned. It can be used in a resolve chain in place of FromFile
+// when the setting must come from the file, so that the omission is reported along with any other errors.
+func (c *Config) FromFileRequired(key string) *string {
+	v := c.FromFile(key)
+	if v == nil {
+		c.addError(&ValueError{Key: c.keyPrefix + key, Source: "file",
+			Err: fmt.Errorf("required file key %q missing", c.keyPrefix+key), kind: ErrMissingValue})
+	}
+	return v
+}
+
+// FromFileTime obtains a native TOML datetime value from the config file, given a string key.
+// If the key holds some other type of value, an error is appended to Config.Errors and you get nil.
+func (c *Config) FromFileTime(key string) *time.Time {
+	fkey, v, ok := c.lookup(key)
+	if !ok {
+		return nil
+	}
+	t, ok := v.(time.Time)
+	if !ok {
+		c.addError(fmt.Errorf("file key '%s' is %T, not a datetime", fkey, v))
+		return nil
+	}
+	return &t
+}
+
+// Has reports whether the loaded config file contains a value for the given key, without converting it.
+// Like FromFile, it takes Config.Environment into account.
+func (c *Config) Has(key string) bool {
+	_, _, ok := c.lookup(key)
+	return ok
+}
+
+// Position returns the line and column in the loaded config file where the value for the key was
+// set, for pointing the user at the right place when reporting a problem. Like FromFile, it takes
+// Config.Environment into account. If the key isn't in the file, or the data didn't come from parsing
+// a TOML file, you get 0, 0.
+func (c *Config) Position(key string) (line int, col int) {
+	fkey, _, ok := c.lookup(key)
+	if !ok {
+		return 0, 0
+	}
+	pos := c.fileData.GetPosition(fkey)
+	return pos.Line, pos.Col
+}
+
+// Comment returns the comment attached to a key in the loaded config file: the comment lines directly
+// above the key, followed by any comment at the end of the key's line, without the leading `#`s. It
+// returns an empty string if the key has no comment or isn't in the file. Comments are only available
+// for a TOML file read by Load, which is read again to find them.
+func (c *Config) Comment(key string) string {
+	line, _ := c.Position(key)
+	r := c.root()
+	if line == 0 || !r.editable {
+		return ""
+	}
+	src, err := ioutil.ReadFile(r.loadedFile)
+	if err != nil {
+		c.addError(err)
+		return ""
+	}
+	return tomlComment(strings.Split(string(src), "\n"), line-1)
+}
+
+// fileValue records the key and original typed value behind a string returned by FromFile, the
+// directory of the file it came from, if known, and whether it's an integer written in decimal.
+type fileValue struct {
+	key     string
+	value   interface{}
+	dir     string
+	decimal bool
+}
+
+// fileOrigin returns the file value behind a string returned by FromFile, if it came from there.
+func (c *Config) fileOrigin(elem *string) (fileValue, bool) {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fv, ok := r.origins[elem]
+	return fv, ok
+}
+
+// origin describes where a value passed to a resolver came from, for use in error messages.
+// Values which didn't come from FromFile result in an empty string.
+func (c *Config) origin(elem *string) string {
+	fv, ok := c.fileOrigin(elem)
+	if !ok {
+		return ""
+	}
+	if fv.isTable() {
+		return fmt.Sprintf(" (file key '%s' is a table, not a scalar value)", fv.key)
+	}
+	return fmt.Sprintf(" (%T from file key '%s')", fv.value, fv.key)
+}
+
+// scalar reports whether the value is present, non-empty and not a table from the config file, for
+// resolvers which parse a single value. Tables result in an error, so that resolution continues with the
+// next value and the error says what was wrong rather than that the JSON text couldn't be parsed.
+func (c *Config) scalar(elem *string) bool {
+	return elem != nil && *elem != "" && !c.isTable(elem)
+}
+
+// isTable reports whether the value is a table or array of tables from the config file, appending an
+// error if it is.
+func (c *Config) isTable(elem *string) bool {
+	fv, ok := c.fileOrigin(elem)
+	if !ok || !fv.isTable() {
+		return false
+	}
+	c.addError(c.valueError(elem, ErrInvalidValue, fmt.Errorf("key '%s' is a table, not a scalar value", fv.key)))
+	return true
+}
+
+// isTable reports whether the file value is a table or array of tables.
+func (fv fileValue) isTable() bool {
+	switch fv.value.(type) {
+	case *toml.Tree, []*toml.Tree:
+		return true
+	}
+	return false
+}
+
+// UserHomeDir is a wrapped version of os.UserHomeDir which appends any error to Config.Errors.
+func (c *Config) UserHomeDir() *string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		c.addError(fmt.Errorf("couldn't locate home directory: %w", err))
+		return nil
+	}
+	return &home
+}
+
+// UserConfigDir is a wrapped version of os.UserConfigDir which appends any error to Config.Errors.
+func (c *Config) UserConfigDir() *string {
+	home, err := os.UserConfigDir()
+	if err != nil {
+		c.addError(fmt.Errorf("couldn't locate home directory: %w", err))
+		return nil
+	}
+	return &home
+}
+
+// Executable is a wrapped version of os.Executable which appends any error to Config.Errors, and
+// returns the directory containing the executable. Symbolic links are resolved if Config.EvalSymlinks
+// is set.
+func (c *Config) Executable() *string {
+	exe, err := c.executable()
+	if err != nil {
+		c.addError(fmt.Errorf("couldn't locate executable: %w", err))
+		return nil
+	}
+	d := path.Dir(exe)
+	return &d
+}
+
+// Default wraps an int, bool, string or time.Duration value to act as default when resolving config values.
+func (c *Config) Default(x interface{}) *string {
+	if x != nil {
 		switch y := x.(type) {
 		case bool:
 			s := strconv.FormatBool(y)
@@ -300,6 +3160,9 @@ func (c *Config) Default(x interface{}) *string {
 		case int:
 			s := strconv.Itoa(y)
 			return &s
+		case time.Duration:
+			s := y.String()
+			return &s
 		case string:
 			return &y
 		default:
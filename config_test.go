@@ -1,11 +1,24 @@
 package config
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
 	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pelletier/go-toml"
 )
 
 var conf *Config
@@ -26,6 +39,7 @@ func TestMain(m *testing.M) {
 			panic(derr)
 		}
 	}()
+	conf.LookupEnv = fakeEnv(testEnv)
 	conf.FindAndLoad(
 		string(os.PathSeparator)+"non_existent_dir",
 		os.TempDir()+"non_existent_file.toml",
@@ -34,15 +48,15 @@ func TestMain(m *testing.M) {
 	if err = os.Setenv("XDG_CONFIG_HOME", testdir); err != nil {
 		panic(err)
 	}
-	if err = os.Setenv("MY_BLANK_ENV_VAR", ""); err != nil {
-		panic(err)
-	}
-	if err = os.Setenv("MY_ENV_VAR", "some bytes"); err != nil {
-		panic(err)
-	}
 	os.Exit(m.Run())
 }
 
+// testEnv is the fake environment used by the tests.
+var testEnv = map[string]string{
+	"MY_BLANK_ENV_VAR": "",
+	"MY_ENV_VAR":       "some bytes",
+}
+
 func makeTestFile() (string, error) {
 	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
 	if err != nil {
@@ -58,6 +72,28 @@ const TOML = `
  beta = 42
  gamma = true
  delta = 3.14159
+ updated = 2023-01-01T00:00:00Z
+ start_date = 2023-01-02
+ run_at = 09:00:00
+ next_run = 2023-01-02T09:30:00
+ hosts = ["a.example.com", "b.example.com"]
+ headers = { X-Api-Key = "abc", Accept = "json" }
+ weights = [1, 2, 3]
+ factors = [0.5, 1.5]
+
+ [[servers]]
+ name = "one"
+ [[servers]]
+ name = "two"
+
+ [database]
+ host = "localhost"
+ port = 5432
+
+ [production]
+ alpha = "Production string"
+ [production.database]
+ host = "db.example.com"
 `
 
 func TestConfig_FromFile(t *testing.T) {
@@ -69,6 +105,11 @@ func TestConfig_FromFile(t *testing.T) {
 		{"beta", "42"},
 		{"gamma", "true"},
 		{"delta", "3.14159"},
+		{"updated", "2023-01-01T00:00:00Z"},
+		{"start_date", "2023-01-02"},
+		{"run_at", "09:00:00"},
+		{"next_run", "2023-01-02T09:30:00"},
+		{"hosts", `["a.example.com","b.example.com"]`},
 	}
 	for _, tt := range tests {
 		r := conf.FromFile(tt.key)
@@ -110,6 +151,124 @@ func TestConfig_ResolveString(t *testing.T) {
 	}
 }
 
+func TestConfig_ResolveStringPtr(t *testing.T) {
+	lc := New("ResolveStringPtr")
+	verify(t, "ResolveStringPtr(nil, empty)", lc.ResolveStringPtr(nil, PS(""), PS("x")), "")
+	verify(t, "ResolveStringPtr(nil, value)", lc.ResolveStringPtr(nil, PS("x")), "x")
+	if lc.ResolveStringPtr(nil, nil) != nil {
+		t.Errorf("ResolveStringPtr gave non-nil for missing values")
+	}
+	if len(lc.Errors) != 0 {
+		t.Errorf("ResolveStringPtr gave errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_ResolveStringSlice(t *testing.T) {
+	var tests = []struct {
+		input  []*string
+		output []string
+		nerrs  int
+	}{
+		{[]*string{PS("a,b,c")}, []string{"a", "b", "c"}, 0},
+		{[]*string{nil, PS(" a, b ;c ")}, []string{"a", "b ;c"}, 0},
+		{[]*string{PS(""), PS(`["a","b,c"]`)}, []string{"a", "b,c"}, 0},
+		{[]*string{PS(`[1, true, "x"]`)}, []string{"1", "true", "x"}, 0},
+		{[]*string{PS(`["a",`), PS("d")}, []string{"d"}, 1},
+		{[]*string{conf.FromFile("hosts")}, []string{"a.example.com", "b.example.com"}, 0},
+		{[]*string{nil}, nil, 1},
+	}
+	lc := New("ResolveStringSlice")
+	for i, tt := range tests {
+		lc.Errors = nil
+		r := lc.ResolveStringSlice(",", tt.input...)
+		if strings.Join(r, "|") != strings.Join(tt.output, "|") || len(r) != len(tt.output) {
+			t.Errorf("ResolveStringSlice test %d gave %q, expected %q", i+1, r, tt.output)
+		}
+		if len(lc.Errors) != tt.nerrs {
+			t.Errorf("ResolveStringSlice test %d gave %d errors, expected %d", i+1, len(lc.Errors), tt.nerrs)
+		}
+	}
+}
+
+func TestConfig_ResolveIntSlice(t *testing.T) {
+	var tests = []struct {
+		input  []*string
+		output []int
+		nerrs  int
+	}{
+		{[]*string{PS("1, 2, 0x10")}, []int{1, 2, 16}, 0},
+		{[]*string{nil, conf.FromFile("weights")}, []int{1, 2, 3}, 0},
+		{[]*string{PS("1,a,b"), PS("[4]")}, []int{4}, 2},
+		{[]*string{nil}, nil, 1},
+	}
+	lc := New("ResolveIntSlice")
+	for i, tt := range tests {
+		lc.Errors = nil
+		r := lc.ResolveIntSlice(",", tt.input...)
+		if fmt.Sprint(r) != fmt.Sprint(tt.output) {
+			t.Errorf("ResolveIntSlice test %d gave %v, expected %v", i+1, r, tt.output)
+		}
+		if len(lc.Errors) != tt.nerrs {
+			t.Errorf("ResolveIntSlice test %d gave %d errors, expected %d", i+1, len(lc.Errors), tt.nerrs)
+		}
+	}
+	lc.Errors = nil
+	lc.ResolveIntSlice(",", PS("1,x"))
+	if !strings.Contains(lc.Errors[0].Error(), "index 1") {
+		t.Errorf("ResolveIntSlice error %q doesn't give element index", lc.Errors[0])
+	}
+}
+
+func TestConfig_ResolveFloatSlice(t *testing.T) {
+	var tests = []struct {
+		input  []*string
+		output []float64
+		nerrs  int
+	}{
+		{[]*string{PS("1.5;-2;3e2")}, []float64{1.5, -2, 300}, 0},
+		{[]*string{nil, conf.FromFile("factors")}, []float64{0.5, 1.5}, 0},
+		{[]*string{PS("x;1"), PS("2")}, []float64{2}, 1},
+		{[]*string{nil}, nil, 1},
+	}
+	lc := New("ResolveFloatSlice")
+	for i, tt := range tests {
+		lc.Errors = nil
+		r := lc.ResolveFloatSlice(";", tt.input...)
+		if fmt.Sprint(r) != fmt.Sprint(tt.output) {
+			t.Errorf("ResolveFloatSlice test %d gave %v, expected %v", i+1, r, tt.output)
+		}
+		if len(lc.Errors) != tt.nerrs {
+			t.Errorf("ResolveFloatSlice test %d gave %d errors, expected %d", i+1, len(lc.Errors), tt.nerrs)
+		}
+	}
+}
+
+func TestConfig_ResolveStringMap(t *testing.T) {
+	var tests = []struct {
+		input  []*string
+		output map[string]string
+		nerrs  int
+	}{
+		{[]*string{PS("X-Api-Key=abc,Accept=json")}, map[string]string{"X-Api-Key": "abc", "Accept": "json"}, 0},
+		{[]*string{nil, PS(" a = 1 , b=x=y")}, map[string]string{"a": "1", "b": "x=y"}, 0},
+		{[]*string{PS(`{"a": "1", "b": 2}`)}, map[string]string{"a": "1", "b": "2"}, 0},
+		{[]*string{conf.FromFile("headers")}, map[string]string{"X-Api-Key": "abc", "Accept": "json"}, 0},
+		{[]*string{PS("a=1,b"), PS("=1"), PS(`{"a"`), PS("c=3")}, map[string]string{"c": "3"}, 3},
+		{[]*string{nil}, nil, 1},
+	}
+	lc := New("ResolveStringMap")
+	for i, tt := range tests {
+		lc.Errors = nil
+		r := lc.ResolveStringMap(tt.input...)
+		if fmt.Sprint(r) != fmt.Sprint(tt.output) {
+			t.Errorf("ResolveStringMap test %d gave %v, expected %v", i+1, r, tt.output)
+		}
+		if len(lc.Errors) != tt.nerrs {
+			t.Errorf("ResolveStringMap test %d gave %d errors, expected %d", i+1, len(lc.Errors), tt.nerrs)
+		}
+	}
+}
+
 func verify(t *testing.T, funcname string, x *string, y string) {
 	if x == nil {
 		t.Errorf("%s returned nil, expected %s", funcname, y)
@@ -148,6 +307,23 @@ func PS(s string) *string {
 	return &s
 }
 
+func TestConfig_ResolveIntRange(t *testing.T) {
+	lc := New("ResolveIntRange")
+	for _, bad := range []string{"nan", "inf", "-inf", "1e19", "-1e19", "99999999999999999999", "9223372036854775808"} {
+		lc.ClearErrors()
+		if n := lc.ResolveInt64(PS(bad), PS("7")); n != 7 || len(lc.Errors) != 1 {
+			t.Errorf("ResolveInt64(%s) gave %d, errors %v", bad, n, lc.Errors)
+		}
+	}
+	lc.ClearErrors()
+	if n := lc.ResolveInt64(PS("-9223372036854775808")); n != math.MinInt64 || len(lc.Errors) != 0 {
+		t.Errorf("ResolveInt64 of MinInt64 gave %d, errors %v", n, lc.Errors)
+	}
+	if n := lc.ResolveInt64(PS("1e18")); n != 1e18 || len(lc.Errors) != 0 {
+		t.Errorf("ResolveInt64(1e18) gave %d, errors %v", n, lc.Errors)
+	}
+}
+
 func TestConfig_ResolveInt(t *testing.T) {
 	var tests = []struct {
 		input  []*string
@@ -159,6 +335,12 @@ func TestConfig_ResolveInt(t *testing.T) {
 		{[]*string{nil, nil, PS("")}, 0, 1},
 		{[]*string{nil, nil, PS("2.612")}, 2, 0},
 		{[]*string{nil, nil, PS("a"), PS("2")}, 2, 1},
+		{[]*string{PS("1e3")}, 1000, 0},
+		{[]*string{PS(".5")}, 0, 0},
+		{[]*string{PS("0x10")}, 16, 0},
+		{[]*string{PS("0x1.8p3")}, 12, 0},
+		{[]*string{PS("-2.612")}, -3, 0},
+		{[]*string{PS("123456789.5")}, 123456789, 0},
 	}
 	lc := New("ResolveInt")
 	for i, tt := range tests {
@@ -198,6 +380,223 @@ func TestConfig_ResolveFloat(t *testing.T) {
 	}
 }
 
+func TestConfig_ResolveFloat32(t *testing.T) {
+	var tests = []struct {
+		input  []*string
+		output float32
+		nerrs  int
+	}{
+		{[]*string{PS("1")}, 1, 0},
+		{[]*string{nil, PS("3.14159")}, 3.14159, 0},
+		{[]*string{nil, nil, PS("-2.612")}, -2.612, 0},
+		{[]*string{PS("1e39"), PS("2")}, 2, 1},
+		{[]*string{nil, nil, PS("a"), PS("2")}, 2, 1},
+		{[]*string{nil}, 0, 1},
+	}
+	lc := New("ResolveFloat32")
+	for i, tt := range tests {
+		lc.Errors = nil
+		r := lc.ResolveFloat32(tt.input...)
+		if r != tt.output {
+			t.Errorf("ResolveFloat32 test %d gave %v, expected %v", i+1, r, tt.output)
+		}
+		if len(lc.Errors) != tt.nerrs {
+			t.Errorf("ResolveFloat32 test %d gave %d errors, expected %d", i+1, len(lc.Errors), tt.nerrs)
+		}
+	}
+}
+
+func TestConfig_ResolvePercent(t *testing.T) {
+	var tests = []struct {
+		input  []*string
+		output float64
+		nerrs  int
+	}{
+		{[]*string{PS("75%")}, 0.75, 0},
+		{[]*string{nil, PS("0.75")}, 0.75, 0},
+		{[]*string{PS(" 10 % ")}, 0.1, 0},
+		{[]*string{PS("1")}, 1, 0},
+		{[]*string{PS("150%"), PS("-0.1"), PS("0.5")}, 0.5, 2},
+		{[]*string{PS("lots"), PS("2%")}, 0.02, 1},
+		{[]*string{PS("NaN"), PS("inf%"), PS("-Inf"), PS("50%")}, 0.5, 3},
+		{[]*string{nil}, 0, 1},
+	}
+	lc := New("ResolvePercent")
+	for i, tt := range tests {
+		lc.Errors = nil
+		r := lc.ResolvePercent(tt.input...)
+		if r != tt.output {
+			t.Errorf("ResolvePercent test %d gave %v, expected %v", i+1, r, tt.output)
+		}
+		if len(lc.Errors) != tt.nerrs {
+			t.Errorf("ResolvePercent test %d gave %d errors, expected %d", i+1, len(lc.Errors), tt.nerrs)
+		}
+	}
+}
+
+func TestConfig_ResolveBigInt(t *testing.T) {
+	var tests = []struct {
+		input  []*string
+		output string
+		nerrs  int
+	}{
+		{[]*string{PS("12345678901234567890123")}, "12345678901234567890123", 0},
+		{[]*string{nil, PS("0x10")}, "16", 0},
+		{[]*string{PS("1.5"), PS("-7")}, "-7", 1},
+		{[]*string{nil}, "0", 1},
+	}
+	lc := New("ResolveBigInt")
+	for i, tt := range tests {
+		lc.Errors = nil
+		r := lc.ResolveBigInt(tt.input...)
+		if r.String() != tt.output {
+			t.Errorf("ResolveBigInt test %d gave %v, expected %v", i+1, r, tt.output)
+		}
+		if len(lc.Errors) != tt.nerrs {
+			t.Errorf("ResolveBigInt test %d gave %d errors, expected %d", i+1, len(lc.Errors), tt.nerrs)
+		}
+	}
+}
+
+func TestConfig_ResolveRat(t *testing.T) {
+	var tests = []struct {
+		input  []*string
+		output string
+		nerrs  int
+	}{
+		{[]*string{PS("22/7")}, "22/7", 0},
+		{[]*string{nil, PS("0.25")}, "1/4", 0},
+		{[]*string{PS("1/0"), PS("a"), PS("3")}, "3/1", 2},
+		{[]*string{nil}, "0/1", 1},
+	}
+	lc := New("ResolveRat")
+	for i, tt := range tests {
+		lc.Errors = nil
+		r := lc.ResolveRat(tt.input...)
+		if r.String() != tt.output {
+			t.Errorf("ResolveRat test %d gave %v, expected %v", i+1, r, tt.output)
+		}
+		if len(lc.Errors) != tt.nerrs {
+			t.Errorf("ResolveRat test %d gave %d errors, expected %d", i+1, len(lc.Errors), tt.nerrs)
+		}
+	}
+}
+
+func TestConfig_ResolveDate(t *testing.T) {
+	lc := conf.Clone()
+	if r := lc.ResolveDate(lc.FromFile("start_date")); r != (toml.LocalDate{Year: 2023, Month: 1, Day: 2}) {
+		t.Errorf("ResolveDate(start_date) gave %v", r)
+	}
+	if r := lc.ResolveDate(PS("2023-02-30"), PS("2024-02-29")); r.String() != "2024-02-29" {
+		t.Errorf("ResolveDate gave %v, expected 2024-02-29", r)
+	}
+	if len(lc.Errors) != 1 {
+		t.Errorf("ResolveDate gave %d errors, expected 1", len(lc.Errors))
+	}
+}
+
+func TestConfig_ResolveTimeOfDay(t *testing.T) {
+	lc := conf.Clone()
+	if r := lc.ResolveTimeOfDay(lc.FromFile("run_at")); r != (toml.LocalTime{Hour: 9}) {
+		t.Errorf("ResolveTimeOfDay(run_at) gave %v", r)
+	}
+	if r := lc.ResolveTimeOfDay(PS("25:00:00"), PS("13:45:30")); r.String() != "13:45:30" {
+		t.Errorf("ResolveTimeOfDay gave %v, expected 13:45:30", r)
+	}
+	if len(lc.Errors) != 1 {
+		t.Errorf("ResolveTimeOfDay gave %d errors, expected 1", len(lc.Errors))
+	}
+}
+
+func TestConfig_ResolveLocalDateTime(t *testing.T) {
+	lc := New("ResolveLocalDateTime")
+	want := toml.LocalDateTime{Date: toml.LocalDate{Year: 2023, Month: 1, Day: 2}, Time: toml.LocalTime{Hour: 9, Minute: 30}}
+	if r := conf.ResolveLocalDateTime(conf.FromFile("next_run")); r != want {
+		t.Errorf("ResolveLocalDateTime(next_run) gave %v", r)
+	}
+	if r := lc.ResolveLocalDateTime(PS("2023-01-02"), PS("2023-01-02 09:30:00")); r != want {
+		t.Errorf("ResolveLocalDateTime gave %v, expected %v", r, want)
+	}
+	if len(lc.Errors) != 1 {
+		t.Errorf("ResolveLocalDateTime gave %d errors, expected 1", len(lc.Errors))
+	}
+}
+
+func TestConfig_ResolveRGBA(t *testing.T) {
+	var tests = []struct {
+		input  []*string
+		output color.RGBA
+		nerrs  int
+	}{
+		{[]*string{PS("#3366ff")}, color.RGBA{0x33, 0x66, 0xff, 0xff}, 0},
+		{[]*string{nil, PS("#36F")}, color.RGBA{0x33, 0x66, 0xff, 0xff}, 0},
+		{[]*string{PS("#3366ff80")}, color.RGBA{0x33, 0x66, 0xff, 0x80}, 0},
+		{[]*string{PS("3366ff"), PS("#12345"), PS("#gg0000"), PS("#000")}, color.RGBA{0, 0, 0, 0xff}, 3},
+		{[]*string{nil}, color.RGBA{}, 1},
+	}
+	lc := New("ResolveRGBA")
+	for i, tt := range tests {
+		lc.Errors = nil
+		r := lc.ResolveRGBA(tt.input...)
+		if r != tt.output {
+			t.Errorf("ResolveRGBA test %d gave %v, expected %v", i+1, r, tt.output)
+		}
+		if len(lc.Errors) != tt.nerrs {
+			t.Errorf("ResolveRGBA test %d gave %d errors, expected %d", i+1, len(lc.Errors), tt.nerrs)
+		}
+	}
+}
+
+func TestConfig_ResolveDurationRange(t *testing.T) {
+	var tests = []struct {
+		input  []*string
+		min    time.Duration
+		max    time.Duration
+		output time.Duration
+		nerrs  int
+	}{
+		{[]*string{PS("1m30s")}, 0, 0, 90 * time.Second, 0},
+		{[]*string{nil, PS("-5s"), PS("5s")}, 0, 0, 5 * time.Second, 1},
+		{[]*string{PS("1h"), PS("10s")}, time.Second, time.Minute, 10 * time.Second, 1},
+		{[]*string{PS("10ms"), PS("2s")}, time.Second, time.Minute, 2 * time.Second, 1},
+		{[]*string{PS("30")}, 0, 0, 0, 2},
+	}
+	lc := New("ResolveDurationRange")
+	for i, tt := range tests {
+		lc.Errors = nil
+		r := lc.ResolveDurationRange(tt.min, tt.max, tt.input...)
+		if r != tt.output {
+			t.Errorf("ResolveDurationRange test %d gave %v, expected %v", i+1, r, tt.output)
+		}
+		if len(lc.Errors) != tt.nerrs {
+			t.Errorf("ResolveDurationRange test %d gave %d errors, expected %d", i+1, len(lc.Errors), tt.nerrs)
+		}
+	}
+	lc.Errors = nil
+	if r := lc.ResolveDuration(PS("-5s")); r != -5*time.Second || len(lc.Errors) != 0 {
+		t.Errorf("ResolveDuration gave %v with %d errors, expected -5s with none", r, len(lc.Errors))
+	}
+}
+
+func TestConfig_missingDefault(t *testing.T) {
+	lc := New("missingDefault")
+	lc.ResolveString()
+	lc.ResolveInt()
+	lc.ResolveFloat32()
+	lc.ResolveFloat64()
+	lc.ResolveDuration()
+	lc.ResolveBool()
+	expected := []string{"string", "int", "float", "float", "duration", "bool"}
+	if len(lc.Errors) != len(expected) {
+		t.Fatalf("Resolve with no values gave %d errors, expected %d", len(lc.Errors), len(expected))
+	}
+	for i, typ := range expected {
+		if msg := lc.Errors[i].Error(); msg != "missing default "+typ+" value" {
+			t.Errorf("missing %s value gave error %q", typ, msg)
+		}
+	}
+}
+
 func TestConfig_stringToBool(t *testing.T) {
 	var tests = []struct {
 		input  string
@@ -235,6 +634,44 @@ func TestConfig_ResolveBool(t *testing.T) {
 	if !conf.ResolveBool(PS("Y")) {
 		t.Errorf("conf.ResolveBool not calling stringToBool properly")
 	}
+	lc := New("ResolveBool")
+	if !lc.ResolveBool(PS("maybe"), lc.Default(true)) {
+		t.Errorf("ResolveBool didn't fall through to default after unrecognized value")
+	}
+	if len(lc.Errors) != 1 {
+		t.Errorf("ResolveBool gave %d errors for unrecognized value, expected 1", len(lc.Errors))
+	}
+}
+
+func TestConfig_ResolveBoolPtr(t *testing.T) {
+	var tests = []struct {
+		input  []*string
+		output string
+		nerrs  int
+	}{
+		{[]*string{PS("true")}, "true", 0},
+		{[]*string{nil, PS("false")}, "false", 0},
+		{[]*string{nil, PS("")}, "nil", 0},
+		{[]*string{PS("maybe"), PS("false")}, "false", 1},
+		{[]*string{PS("maybe")}, "nil", 1},
+		{[]*string{}, "nil", 0},
+		{[]*string{conf.FromFile("gamma"), PS("false")}, "true", 0},
+	}
+	lc := New("ResolveBoolPtr")
+	for i, tt := range tests {
+		lc.Errors = nil
+		r := lc.ResolveBoolPtr(tt.input...)
+		rs := "nil"
+		if r != nil {
+			rs = fmt.Sprint(*r)
+		}
+		if rs != tt.output {
+			t.Errorf("ResolveBoolPtr test %d gave %s, expected %s", i+1, rs, tt.output)
+		}
+		if len(lc.Errors) != tt.nerrs {
+			t.Errorf("ResolveBoolPtr test %d gave %d errors, expected %d", i+1, len(lc.Errors), tt.nerrs)
+		}
+	}
 }
 
 func TestConfig_FromEnv(t *testing.T) {
@@ -259,6 +696,25 @@ func TestConfig_FromEnv(t *testing.T) {
 	}
 }
 
+// fakeEnv returns a function suitable for Config.LookupEnv which looks variables up in a map.
+func fakeEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func TestConfig_LookupEnv(t *testing.T) {
+	lc := New("LookupEnv")
+	lc.LookupEnv = fakeEnv(map[string]string{"FAKE_ENV_VAR": "fake", "MY_ENV_VAR": "replaced"})
+	verify(t, "FromEnv(FAKE_ENV_VAR)", lc.FromEnv("FAKE_ENV_VAR"), "fake")
+	verify(t, "FromEnv(MY_ENV_VAR)", lc.FromEnv("MY_ENV_VAR"), "replaced")
+	if lc.FromEnv("MY_BLANK_ENV_VAR") != nil {
+		t.Errorf("FromEnv(MY_BLANK_ENV_VAR) gave non-nil with fake environment")
+	}
+	verify(t, "Sub(x).FromEnv(FAKE_ENV_VAR)", lc.Sub("x").FromEnv("FAKE_ENV_VAR"), "fake")
+}
+
 func TestHome_UserConfigDir(t *testing.T) {
 	c1 := conf.UserHomeDir()
 	c2, _ := os.UserHomeDir()
@@ -277,9 +733,103 @@ func TestConfig_Executable(t *testing.T) {
 	verify(t, "Executable", c1, path.Dir(c2))
 }
 
+func TestConfig_ExecutableEvalSymlinks(t *testing.T) {
+	lc := New("ExecutableEvalSymlinks")
+	lc.EvalSymlinks = true
+	exe, _ := os.Executable()
+	real, err := filepath.EvalSymlinks(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify(t, "Executable", lc.Executable(), filepath.Dir(real))
+	if fn := lc.FileFromExecutable(); fn != filepath.Join(filepath.Dir(real), "config.toml") {
+		t.Errorf("FileFromExecutable gave %s, expected config.toml next to %s", fn, real)
+	}
+}
+
+func TestConfig_FilesFromHome(t *testing.T) {
+	lc := New("FilesFromHome")
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	got := lc.FilesFromHome("config", "myapp")
+	want := []string{filepath.Join(dir, "FilesFromHome", "config.toml"), filepath.Join(dir, "FilesFromHome", "myapp.toml")}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("FilesFromHome gave %v, expected %v", got, want)
+	}
+	if got = lc.FilesFromHome(); len(got) != 1 || got[0] != lc.FileFromHome() {
+		t.Errorf("FilesFromHome() gave %v, expected FileFromHome", got)
+	}
+	if got = lc.FilesFromExecutable("a", "b"); len(got) != 2 || filepath.Dir(got[1]) != *lc.Executable() {
+		t.Errorf("FilesFromExecutable gave %v", got)
+	}
+}
+
+func TestConfig_FindUpward(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	deep := filepath.Join(tmpdir, "project", "src", "pkg")
+	if err = os.MkdirAll(deep, 0700); err != nil {
+		t.Fatal(err)
+	}
+	lc := New("FindUpward")
+	lc.FileBase = "findupward-test"
+	if fn := lc.FindUpward(deep); fn != "" {
+		t.Errorf("FindUpward gave %s with no file", fn)
+	}
+	want := filepath.Join(tmpdir, "project", "findupward-test.toml")
+	if err = ioutil.WriteFile(want, []byte("x = 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if fn := lc.FindUpward(deep); fn != want {
+		t.Errorf("FindUpward gave %s, expected %s", fn, want)
+	}
+	if fn := lc.FindUpward(filepath.Join(tmpdir, "project")); fn != want {
+		t.Errorf("FindUpward from the file's directory gave %s, expected %s", fn, want)
+	}
+	if fn := lc.FindUpward(tmpdir); fn != "" || len(lc.Errors) != 0 {
+		t.Errorf("FindUpward above the file gave %s, errors %v", fn, lc.Errors)
+	}
+}
+
+func TestConfig_FindWithExtensions(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	lc := New("FindWithExtensions")
+	if fn := lc.FindWithExtensions(tmpdir, "config"); fn != "" {
+		t.Errorf("FindWithExtensions gave %s with no files", fn)
+	}
+	jsonfn := filepath.Join(tmpdir, "config.json")
+	if err = ioutil.WriteFile(jsonfn, []byte(`{"alpha": "from json"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(tmpdir, "config.ini"), []byte("alpha = from ini\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fn := lc.FindWithExtensions(tmpdir, "config")
+	if fn != jsonfn {
+		t.Fatalf("FindWithExtensions gave %s, expected %s", fn, jsonfn)
+	}
+	lc.Load(fn)
+	verify(t, "FromFile(alpha)", lc.FromFile("alpha"), "from json")
+	if lc.LoadedFormat() != "json" {
+		t.Errorf("LoadedFormat gave %s, expected json", lc.LoadedFormat())
+	}
+	if fn = lc.FindWithExtensions(tmpdir, "config", ".yaml", "ini", "json"); fn != filepath.Join(tmpdir, "config.ini") {
+		t.Errorf("FindWithExtensions with extensions gave %s", fn)
+	}
+}
+
 func TestConfig_Default(t *testing.T) {
-	testvals := []interface{}{"one value", 2, true}
-	retvals := []interface{}{"one value", "2", "true"}
+	testvals := []interface{}{"one value", 2, true, 90 * time.Second}
+	retvals := []interface{}{"one value", "2", "true", "1m30s"}
 	for i, v := range testvals {
 		pt := conf.Default(v)
 		if pt == nil {
@@ -291,3 +841,1812 @@ func TestConfig_Default(t *testing.T) {
 		}
 	}
 }
+
+func TestConfig_FileFromEnv(t *testing.T) {
+	lc := New("FileFromEnv")
+	lc.LookupEnv = fakeEnv(testEnv)
+	if fn := lc.FileFromEnv("MY_UNSET_ENV_VAR"); fn != "" {
+		t.Errorf("FileFromEnv gave %s for unset variable, expected empty string", fn)
+	}
+	if fn := lc.FileFromEnv("MY_BLANK_ENV_VAR"); fn != "" {
+		t.Errorf("FileFromEnv gave %s for blank variable, expected empty string", fn)
+	}
+	if len(lc.Errors) != 0 {
+		t.Errorf("FileFromEnv gave %d errors for unset variables, expected 0", len(lc.Errors))
+	}
+	if fn := lc.FileFromEnv("MY_ENV_VAR"); fn != "some bytes" {
+		t.Errorf("FileFromEnv gave %s, expected some bytes", fn)
+	}
+	if len(lc.Errors) != 1 {
+		t.Errorf("FileFromEnv gave %d errors for missing file, expected 1", len(lc.Errors))
+	}
+}
+
+func TestConfig_Sub(t *testing.T) {
+	db := conf.Sub("database")
+	verify(t, "Sub(database).FromFile(host)", db.FromFile("host"), "localhost")
+	verify(t, "Sub(database).FromFile(port)", db.FromFile("port"), "5432")
+	if db.FromFile("alpha") != nil {
+		t.Errorf("Sub(database).FromFile(alpha) gave non-nil")
+	}
+	if conf.Sub("zeta").FromFile("host") != nil {
+		t.Errorf("Sub(zeta).FromFile(host) gave non-nil")
+	}
+	lc := New("Sub")
+	sub := lc.Sub("database")
+	sub.ResolveString()
+	if len(sub.Errors) != 0 || len(lc.Errors) != 1 {
+		t.Errorf("Sub recorded %d errors on child and %d on parent, expected 0 and 1",
+			len(sub.Errors), len(lc.Errors))
+	}
+}
+
+func TestConfig_SubEnvironment(t *testing.T) {
+	lc := New("SubEnvironment")
+	if err := lc.LoadReader(strings.NewReader("[database]\nhost = \"localhost\"\nport = 5432\n"+
+		"[database.tls]\ncert = \"dev.pem\"\n[production.database]\nhost = \"db.example.com\"\n"+
+		"[production.database.tls]\ncert = \"prod.pem\"\n[production.cache]\nhost = \"cache.example.com\"\n"), "toml"); err != nil {
+		t.Fatal(err)
+	}
+	lc.Environment = "production"
+	db := lc.Sub("database")
+	verify(t, "Sub(database).FromFile(host)", db.FromFile("host"), "db.example.com")
+	verify(t, "Sub(database).FromFile(port)", db.FromFile("port"), "5432")
+	verify(t, "Sub(database).Sub(tls).FromFile(cert)", db.Sub("tls").FromFile("cert"), "prod.pem")
+	verify(t, "Sub(cache).FromFile(host)", lc.Sub("cache").FromFile("host"), "cache.example.com")
+	verify(t, "FromFile(database.host)", lc.FromFile("database.host"), "db.example.com")
+	lc.Environment = "staging"
+	verify(t, "Sub(database).FromFile(host) in staging", lc.Sub("database").FromFile("host"), "localhost")
+	if len(lc.Errors) != 0 {
+		t.Errorf("Sub gave errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_origin(t *testing.T) {
+	lc := New("origin")
+	lc.fileData = conf.fileData
+	lc.ResolveInt(lc.FromFile("gamma"))
+	if len(lc.Errors) != 2 {
+		t.Fatalf("ResolveInt of bool file value gave %d errors, expected 2", len(lc.Errors))
+	}
+	msg := lc.Errors[0].Error()
+	if !strings.Contains(msg, "bool") || !strings.Contains(msg, "gamma") {
+		t.Errorf("ResolveInt error %q doesn't mention original type and key", msg)
+	}
+	lc.Errors = nil
+	lc.ResolveInt(PS("true"))
+	if len(lc.Errors) > 0 && strings.Contains(lc.Errors[0].Error(), "file key") {
+		t.Errorf("ResolveInt error %q mentions file for non-file value", lc.Errors[0])
+	}
+}
+
+func TestConfig_WriteFile(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	fn := filepath.Join(tmpdir, "MyAppName", "config.toml")
+	lc := New("WriteFile")
+	lc.fileData = conf.fileData
+	lc.WriteFile(fn)
+	if len(lc.Errors) != 0 {
+		t.Fatalf("WriteFile gave errors %v", lc.Errors)
+	}
+	fi, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("WriteFile created file with mode %v, expected 0600", fi.Mode().Perm())
+	}
+	rc := New("WriteFile")
+	rc.Load(fn)
+	verify(t, "FromFile(alpha) after WriteFile", rc.FromFile("alpha"), "Some string")
+	verify(t, "FromFile(database.port) after WriteFile", rc.FromFile("database.port"), "5432")
+}
+
+func TestConfig_WriteFileComments(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	fn := filepath.Join(tmpdir, "config.toml")
+	src := `# Settings for my app
+name = "demo" # shown in the title bar
+
+# Database connection
+[database]
+host = "localhost"  # change for production
+port = 5432
+`
+	if err = ioutil.WriteFile(fn, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lc := New("WriteFileComments")
+	lc.Load(fn)
+	lc.Set("database.host", "db.example.com")
+	lc.Sub("database").Set("user", "admin")
+	lc.Set("debug", true)
+	lc.WriteFile(fn)
+	if len(lc.Errors) != 0 {
+		t.Fatalf("WriteFile gave errors %v", lc.Errors)
+	}
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# Settings for my app
+name = "demo" # shown in the title bar
+debug = true
+
+# Database connection
+[database]
+host = "db.example.com"  # change for production
+port = 5432
+user = "admin"
+`
+	if string(data) != expected {
+		t.Errorf("WriteFile gave\n%s\nexpected\n%s", data, expected)
+	}
+}
+
+func TestConfig_Save(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	fn := filepath.Join(tmpdir, "config.toml")
+	if err = ioutil.WriteFile(fn, []byte("port = 80\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(tmpdir, "link.toml")
+	if err = os.Symlink(fn, link); err != nil {
+		t.Skip(err)
+	}
+	lc := New("Save")
+	lc.Load(link)
+	lc.Set("port", int64(8080))
+	lc.Save()
+	if len(lc.Errors) != 0 {
+		t.Fatalf("Save gave errors %v", lc.Errors)
+	}
+	rc := New("Save")
+	rc.Load(fn)
+	verify(t, "FromFile(port) after Save", rc.FromFile("port"), "8080")
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Save replaced symbolic link")
+	}
+	if fi, err := os.Stat(fn); err != nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("Save didn't keep permissions 0640, gave %v", fi.Mode().Perm())
+	}
+	entries, err := ioutil.ReadDir(tmpdir)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Save left extra files in %s: %v", tmpdir, entries)
+	}
+	nc := New("Save")
+	nc.Set("x", 1)
+	nc.Save()
+	if len(nc.Errors) != 1 {
+		t.Errorf("Save without a loaded file gave errors %v", nc.Errors)
+	}
+}
+
+func TestConfig_SaveMerged(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	system := filepath.Join(tmpdir, "system.toml")
+	local := filepath.Join(tmpdir, "local.toml")
+	systemSrc := "# System defaults\nhost = \"sys.example.com\"\nport = 80\n"
+	if err = ioutil.WriteFile(system, []byte(systemSrc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(local, []byte("# Local settings\nport = 8080 # dev server\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lc := New("SaveMerged")
+	lc.FindAndLoadAll(system, local)
+	lc.Set("port", int64(9090))
+	lc.Set("debug", true)
+	lc.Save()
+	if len(lc.Errors) != 0 {
+		t.Fatalf("Save gave errors %v", lc.Errors)
+	}
+	expected := "# Local settings\nport = 9090 # dev server\ndebug = true\n"
+	if b, err := ioutil.ReadFile(local); err != nil || string(b) != expected {
+		t.Errorf("Save after merge wrote\n%s\nexpected\n%s", b, expected)
+	}
+	if b, err := ioutil.ReadFile(system); err != nil || string(b) != systemSrc {
+		t.Errorf("Save after merge changed the system file to\n%s", b)
+	}
+}
+
+func TestConfig_Comment(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	fn := filepath.Join(tmpdir, "config.toml")
+	src := `name = "demo" # shown in the title bar
+
+# Database connection
+[database]
+# Host name or IP address
+# of the server
+  host = "localhost"  # change for production
+port = 5432
+`
+	if err = ioutil.WriteFile(fn, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lc := New("Comment")
+	lc.Load(fn)
+	tests := []struct {
+		key     string
+		line    int
+		col     int
+		comment string
+	}{
+		{"name", 1, 1, "shown in the title bar"},
+		{"database.host", 7, 3, "Host name or IP address\nof the server\nchange for production"},
+		{"database.port", 8, 1, ""},
+		{"missing", 0, 0, ""},
+	}
+	for _, tt := range tests {
+		if line, col := lc.Position(tt.key); line != tt.line || col != tt.col {
+			t.Errorf("Position(%s) gave %d, %d, expected %d, %d", tt.key, line, col, tt.line, tt.col)
+		}
+		if c := lc.Comment(tt.key); c != tt.comment {
+			t.Errorf("Comment(%s) gave %q, expected %q", tt.key, c, tt.comment)
+		}
+	}
+	if c := lc.Sub("database").Comment("port"); c != "" {
+		t.Errorf("Comment(port) on sub-config gave %q", c)
+	}
+	if line, _ := lc.Sub("database").Position("host"); line != 7 {
+		t.Errorf("Position(host) on sub-config gave line %d", line)
+	}
+}
+
+func TestConfig_ResolveNamed(t *testing.T) {
+	lc := New("ResolveNamed")
+	var streamed []error
+	lc.OnError = func(err error) { streamed = append(streamed, err) }
+	if r := lc.ResolveIntNamed("database.port", PS("x"), PS("5432")); r != 5432 {
+		t.Errorf("ResolveIntNamed gave %d, expected 5432", r)
+	}
+	lc.ResolveStringNamed("database.host")
+	lc.ResolveFloat64Named("ratio")
+	lc.ResolveBoolNamed("debug")
+	lc.ResolveDurationNamed("timeout")
+	expected := []string{"database.port", "database.host", "ratio", "debug", "timeout"}
+	if len(lc.Errors) != len(expected) {
+		t.Fatalf("Resolve*Named gave %d errors, expected %d", len(lc.Errors), len(expected))
+	}
+	for i, name := range expected {
+		if !strings.HasPrefix(lc.Errors[i].Error(), "resolving '"+name+"': ") {
+			t.Errorf("Resolve*Named gave error %q, expected it to name %s", lc.Errors[i], name)
+		}
+		if i < len(streamed) && streamed[i].Error() != lc.Errors[i].Error() {
+			t.Errorf("Resolve*Named passed error %q to OnError, expected %q", streamed[i], lc.Errors[i])
+		}
+	}
+	if len(streamed) != len(expected) {
+		t.Errorf("Resolve*Named passed %d errors to OnError, expected %d", len(streamed), len(expected))
+	}
+	lc.ClearErrors()
+	lc.ResolveInt(PS("x"))
+	if len(lc.Errors) != 2 || strings.Contains(lc.Errors[0].Error(), "resolving") {
+		t.Errorf("ResolveInt after Resolve*Named gave errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_MustResolve(t *testing.T) {
+	lc := New("MustResolve")
+	if v := lc.MustResolveInt(nil, PS("42")); v != 42 {
+		t.Errorf("MustResolveInt gave %d, expected 42", v)
+	}
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatalf("MustResolveInt didn't panic on bad values")
+		}
+		msg := fmt.Sprint(r)
+		if !strings.Contains(msg, "'a'") || !strings.Contains(msg, "missing default int value") {
+			t.Errorf("MustResolveInt panic message %q doesn't list all errors", msg)
+		}
+	}()
+	lc.MustResolveInt(PS("a"))
+}
+
+func TestConfig_MustResolveNamed(t *testing.T) {
+	lc := New("MustResolveNamed")
+	if v := lc.MustResolveStringNamed("database.host", nil, PS("localhost")); v != "localhost" {
+		t.Errorf("MustResolveStringNamed gave %q, expected localhost", v)
+	}
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatalf("MustResolveDurationNamed didn't panic on missing value")
+		}
+		msg := fmt.Sprint(r)
+		if msg != "config resolution failed: resolving 'timeout': missing default duration value" {
+			t.Errorf("MustResolveDurationNamed panic message %q doesn't name the setting", msg)
+		}
+	}()
+	lc.MustResolveDurationNamed("timeout", nil)
+}
+
+func TestConfig_MustResolveNamedParseError(t *testing.T) {
+	lc := New("MustResolveNamedParseError")
+	if v := lc.MustResolveIntNamed("port", PS("eighty"), PS("8080")); v != 8080 {
+		t.Errorf("MustResolveIntNamed gave %d, expected 8080", v)
+	}
+	if len(lc.Errors) != 1 {
+		t.Errorf("MustResolveIntNamed recorded errors %v, expected the parse error", lc.Errors)
+	}
+	defer func() {
+		msg := fmt.Sprint(recover())
+		if !strings.Contains(msg, "eighty") || !strings.Contains(msg, "missing default int value") {
+			t.Errorf("MustResolveIntNamed panic message %q doesn't list the parse and missing value errors", msg)
+		}
+	}()
+	lc.MustResolveIntNamed("port", PS("eighty"))
+}
+
+func TestConfig_Has(t *testing.T) {
+	var tests = []struct {
+		key    string
+		output bool
+	}{
+		{"alpha", true},
+		{"database", true},
+		{"database.port", true},
+		{"zeta", false},
+	}
+	for _, tt := range tests {
+		if r := conf.Has(tt.key); r != tt.output {
+			t.Errorf("Has(%s) gave %v, expected %v", tt.key, r, tt.output)
+		}
+	}
+	if New("Has").Has("alpha") {
+		t.Errorf("Has(alpha) gave true with no file loaded")
+	}
+}
+
+func TestConfig_FromFileRequired(t *testing.T) {
+	lc := conf.Clone()
+	verify(t, "FromFileRequired(alpha)", lc.FromFileRequired("alpha"), "Some string")
+	if len(lc.Errors) != 0 {
+		t.Errorf("FromFileRequired(alpha) gave errors %v", lc.Errors)
+	}
+	x := lc.ResolveString(lc.Sub("database").FromFileRequired("user"), PS("admin"))
+	if x != "admin" || len(lc.Errors) != 1 {
+		t.Fatalf("FromFileRequired(user) gave %q, errors %v", x, lc.Errors)
+	}
+	if !errors.Is(lc.Errors[0], ErrMissingValue) || lc.Errors[0].Error() != `required file key "database.user" missing` {
+		t.Errorf("FromFileRequired(user) gave error %v", lc.Errors[0])
+	}
+}
+
+func TestConfig_FromFileTime(t *testing.T) {
+	lc := New("FromFileTime")
+	lc.fileData = conf.fileData
+	r := lc.FromFileTime("updated")
+	if r == nil {
+		t.Fatalf("FromFileTime(updated) gave nil")
+	}
+	if !r.Equal(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("FromFileTime(updated) gave %v", *r)
+	}
+	if lc.FromFileTime("zeta") != nil || len(lc.Errors) != 0 {
+		t.Errorf("FromFileTime(zeta) gave non-nil or errors")
+	}
+	if lc.FromFileTime("alpha") != nil || len(lc.Errors) != 1 {
+		t.Errorf("FromFileTime(alpha) gave non-nil or no error")
+	}
+}
+
+func TestConfig_UseCommonBools(t *testing.T) {
+	lc := New("UseCommonBools")
+	if _, ok := lc.stringToBool("on"); ok {
+		t.Errorf("stringToBool accepted on before UseCommonBools")
+	}
+	lc.UseCommonBools()
+	var tests = []struct {
+		input  string
+		output bool
+	}{
+		{"true", true},
+		{"Yes", true},
+		{"ON", true},
+		{"enabled", true},
+		{"1", true},
+		{"Y", true},
+		{"false", false},
+		{"no", false},
+		{"n", false},
+		{"off", false},
+		{"Disabled", false},
+		{"0", false},
+	}
+	for _, tt := range tests {
+		r, ok := lc.stringToBool(tt.input)
+		if !ok || r != tt.output {
+			t.Errorf("stringToBool %s gave %v, %v, expected %v, true", tt.input, r, ok, tt.output)
+		}
+	}
+	n := len(lc.TrueStrings)
+	lc.UseCommonBools()
+	if len(lc.TrueStrings) != n {
+		t.Errorf("calling UseCommonBools twice gave TrueStrings %v", lc.TrueStrings)
+	}
+}
+
+func TestConfig_Clone(t *testing.T) {
+	lc := New("Clone")
+	lc.fileData = conf.fileData
+	lc.ResolveString()
+	cc := lc.Clone()
+	if len(cc.Errors) != 0 {
+		t.Errorf("Clone kept %d errors, expected 0", len(cc.Errors))
+	}
+	if cc.AppName != "Clone" {
+		t.Errorf("Clone gave AppName %s, expected Clone", cc.AppName)
+	}
+	verify(t, "Clone().FromFile(alpha)", cc.FromFile("alpha"), "Some string")
+	cc.Set("alpha", "Clone string")
+	cc.Set("database.host", "clone.example.com")
+	verify(t, "Clone().FromFile(alpha) after Set", cc.FromFile("alpha"), "Clone string")
+	verify(t, "Clone().FromFile(database.host) after Set", cc.FromFile("database.host"), "clone.example.com")
+	verify(t, "FromFile(alpha) after Set on clone", lc.FromFile("alpha"), "Some string")
+	verify(t, "FromFile(database.host) after Set on clone", lc.FromFile("database.host"), "localhost")
+	cc.UseCommonBools()
+	if len(lc.TrueStrings) != 1 {
+		t.Errorf("Changing TrueStrings on clone affected original")
+	}
+}
+
+func TestConfig_LoadedFile(t *testing.T) {
+	if filepath.Base(conf.LoadedFile()) != "test.toml" {
+		t.Errorf("LoadedFile gave %s, expected test.toml", conf.LoadedFile())
+	}
+	if sub := conf.Sub("database"); sub.LoadedFile() != conf.LoadedFile() || sub.LoadedFormat() != "toml" {
+		t.Errorf("sub-config LoadedFile gave %s (%s), expected %s", sub.LoadedFile(), sub.LoadedFormat(), conf.LoadedFile())
+	}
+	if conf.LoadedFormat() != "toml" {
+		t.Errorf("LoadedFormat gave %s, expected toml", conf.LoadedFormat())
+	}
+	lc := New("LoadedFile")
+	lc.Load(os.TempDir() + "non_existent_file.toml")
+	if lc.LoadedFile() != "" || lc.LoadedFormat() != "" {
+		t.Errorf("LoadedFile and LoadedFormat non-empty after failed Load")
+	}
+}
+
+func TestConfig_Environment(t *testing.T) {
+	lc := conf.Clone()
+	lc.Environment = "production"
+	verify(t, "FromFile(alpha) in production", lc.FromFile("alpha"), "Production string")
+	verify(t, "FromFile(beta) in production", lc.FromFile("beta"), "42")
+	verify(t, "FromFile(database.host) in production", lc.FromFile("database.host"), "db.example.com")
+	verify(t, "FromFile(database.port) in production", lc.FromFile("database.port"), "5432")
+	lc.Environment = "staging"
+	verify(t, "FromFile(alpha) in staging", lc.FromFile("alpha"), "Some string")
+}
+
+func TestConfig_RequireKeys(t *testing.T) {
+	lc := New("RequireKeys")
+	lc.LookupEnv = fakeEnv(map[string]string{"REQUIREKEYS_FROM_ENV": "set"})
+	lc.RequireKeys("alpha", "database.host", "from-env", "missing.key")
+	lc.Load(conf.LoadedFile())
+	if len(lc.Errors) != 1 {
+		t.Fatalf("Load with required keys gave %d errors, expected 1", len(lc.Errors))
+	}
+	if msg := lc.Errors[0].Error(); !strings.Contains(msg, "missing.key") || !strings.Contains(msg, "REQUIREKEYS_MISSING_KEY") {
+		t.Errorf("RequireKeys error %q doesn't name key and environment variable", msg)
+	}
+
+	nc := New("RequireKeys")
+	nc.LookupEnv = lc.LookupEnv
+	nc.RequireKeys("from-env", "missing.key")
+	if fn := nc.FindAndLoad(filepath.Join(os.TempDir(), "GoLparConfigTest-nonexistent.toml")); fn != "" {
+		t.Fatalf("FindAndLoad found %s", fn)
+	}
+	if len(nc.Errors) != 1 || !errors.Is(nc.Errors[0], ErrMissingValue) {
+		t.Errorf("FindAndLoad with no file gave errors %v, expected missing.key to be reported", nc.Errors)
+	}
+	nc.ClearErrors()
+	if errs := nc.CheckRequired(); len(errs) != 1 || len(nc.Errors) != 1 {
+		t.Errorf("CheckRequired returned %v and recorded %v, expected one error", errs, nc.Errors)
+	}
+}
+
+func TestConfig_LoadInclude(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	files := map[string]string{
+		"main.toml":         "include = [\"db.toml\", \"conf.d/cache.toml\"]\nname = \"main\"\n[db]\nport = 5433\n",
+		"db.toml":           "name = \"db\"\n[db]\nhost = \"localhost\"\nport = 5432\n",
+		"conf.d/cache.toml": "include = \"../legacy.ini\"\n[cache]\nsize = 64\n",
+		"legacy.ini":        "[cache]\nsize = 32\nttl = 60\n",
+		"cycle1.toml":       "include = [\"cycle2.toml\"]\n",
+		"cycle2.toml":       "include = [\"cycle1.toml\"]\n",
+	}
+	for name, data := range files {
+		fn := filepath.Join(tmpdir, name)
+		if err = os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(fn, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lc := New("LoadInclude")
+	lc.Load(filepath.Join(tmpdir, "main.toml"))
+	if len(lc.Errors) != 0 {
+		t.Fatalf("Load with includes gave errors %v", lc.Errors)
+	}
+	verify(t, "FromFile(name)", lc.FromFile("name"), "main")
+	verify(t, "FromFile(db.host)", lc.FromFile("db.host"), "localhost")
+	verify(t, "FromFile(db.port)", lc.FromFile("db.port"), "5433")
+	verify(t, "FromFile(cache.size)", lc.FromFile("cache.size"), "64")
+	verify(t, "FromFile(cache.ttl)", lc.FromFile("cache.ttl"), "60")
+	if lc.Has("include") {
+		t.Errorf("include key present after Load")
+	}
+	lc.Load(filepath.Join(tmpdir, "cycle1.toml"))
+	if len(lc.Errors) != 1 || !strings.Contains(lc.Errors[0].Error(), "cycle") {
+		t.Errorf("Load of include cycle gave errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_FindUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("file permissions aren't enforced for root")
+	}
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	unreadable := filepath.Join(tmpdir, "unreadable.toml")
+	if err = ioutil.WriteFile(unreadable, []byte(TOML), 0000); err != nil {
+		t.Fatal(err)
+	}
+	lc := New("FindUnreadable")
+	if fn := lc.Find(unreadable, conf.LoadedFile()); fn != "" {
+		t.Errorf("Find gave %s, expected no file", fn)
+	}
+	if len(lc.Errors) != 1 || !strings.Contains(lc.Errors[0].Error(), "unreadable") {
+		t.Errorf("Find gave errors %v, expected unreadable file error", lc.Errors)
+	}
+}
+
+func TestConfig_Set(t *testing.T) {
+	lc := New("Set")
+	lc.Set("server.port", 8080)
+	verify(t, "FromFile(server.port) after Set", lc.FromFile("server.port"), "8080")
+	lc.Set("ratio", float32(0.5))
+	lc.Set("ids", []int{1, 2})
+	if v, ok := lc.fileData.Get("server.port").(int64); !ok || v != 8080 {
+		t.Errorf("Set(server.port, 8080) stored %T %v, expected int64", lc.fileData.Get("server.port"), lc.fileData.Get("server.port"))
+	}
+	if s, err := lc.fileData.ToTomlString(); err != nil || !strings.Contains(s, "ratio = 0.5") || !strings.Contains(s, "ids = [1, 2]") {
+		t.Errorf("data after Set gave %q with error %v", s, err)
+	}
+}
+
+func TestConfig_SetSub(t *testing.T) {
+	lc := New("SetSub")
+	if err := lc.LoadReader(strings.NewReader("[database]\nhost = \"localhost\"\n"+
+		"[production.database]\nhost = \"db.example.com\"\n"), "toml"); err != nil {
+		t.Fatal(err)
+	}
+	lc.Environment = "production"
+	db := lc.Sub("database")
+	db.Set("port", 5432)
+	lc.Sub("cache").Sub("redis").Set("host", "cache.example.com")
+	verify(t, "Sub(database).FromFile(port)", db.FromFile("port"), "5432")
+	verify(t, "FromFile(database.port)", lc.FromFile("database.port"), "5432")
+	verify(t, "FromFile(cache.redis.host)", lc.FromFile("cache.redis.host"), "cache.example.com")
+	verify(t, "FromFile(database.host)", lc.FromFile("database.host"), "db.example.com")
+	if s, err := lc.fileData.ToTomlString(); err != nil || !strings.Contains(s, "port = 5432") {
+		t.Errorf("data after Sub.Set gave %q with error %v", s, err)
+	}
+}
+
+func TestConfig_TrimValues(t *testing.T) {
+	lc := New("TrimValues")
+	lc.LookupEnv = fakeEnv(map[string]string{"TOKEN": "abc123\n", "PORT": " 8080 "})
+	lc.Set("name", "  padded  ")
+	verify(t, "FromEnv(TOKEN) untrimmed", lc.FromEnv("TOKEN"), "abc123\n")
+	lc.TrimValues = true
+	verify(t, "FromEnv(TOKEN)", lc.FromEnv("TOKEN"), "abc123")
+	verify(t, "FromFile(name)", lc.FromFile("name"), "padded")
+	if r := lc.ResolveString(lc.FromEnv("TOKEN")); r != "abc123" {
+		t.Errorf("ResolveString gave %q with TrimValues, expected abc123", r)
+	}
+	if r := lc.ResolveInt(lc.FromEnv("PORT")); r != 8080 || len(lc.Errors) != 0 {
+		t.Errorf("ResolveInt gave %d with errors %v, expected 8080", r, lc.Errors)
+	}
+}
+
+func TestConfig_EnvDebug(t *testing.T) {
+	os.Setenv("ENVDEBUG_CONFIG_DEBUG", "1")
+	defer os.Unsetenv("ENVDEBUG_CONFIG_DEBUG")
+	lc := New("envdebug")
+	if !lc.EnvDebug {
+		t.Fatalf("New didn't enable EnvDebug from ENVDEBUG_CONFIG_DEBUG")
+	}
+	lc.fileData = conf.fileData
+	lc.LookupEnv = fakeEnv(map[string]string{"ENVDEBUG_DB_HOST": "db.example.com", "DB_PASSWORD": "hunter2"})
+	var buf strings.Builder
+	lc.debugOut = &buf
+	lc.ResolveStringNamed("db.host", lc.FromDerivedEnv("db.host"), lc.FromFile("database.host"))
+	lc.ResolveIntNamed("db.port", lc.FromDerivedEnv("db.port"), lc.FromFile("database.port"))
+	lc.ResolveStringNamed("db.password", lc.FromEnv("DB_PASSWORD"))
+	lc.ResolveIntNamed("db.pool", nil, PS("10"))
+	lc.ResolveStringNamed("db.user", nil, PS(""))
+	lc.ResolveIntNamed("db.timeout", PS("eighty"), PS("30"))
+	lc.ResolveStringNamed("db.name", PS(""), PS("app"))
+	var s struct{ Port int }
+	lc.UnmarshalKey("database", &s)
+	want := `resolved db.host from ENVDEBUG_DB_HOST = "db.example.com"
+resolved db.port from file key 'database.port' = "5432"
+resolved db.password from DB_PASSWORD = ***
+resolved db.pool from value 2 = "10"
+resolved db.user from value 2 = ""
+resolved db.timeout from value 2 = "30"
+resolved db.name from value 1 = ""
+resolved database.port from file key 'database.port' = "5432"
+`
+	if buf.String() != want {
+		t.Errorf("EnvDebug gave\n%s\nexpected\n%s", buf.String(), want)
+	}
+	os.Setenv("ENVDEBUG_CONFIG_DEBUG", "0")
+	if New("envdebug").EnvDebug {
+		t.Errorf("New enabled EnvDebug with ENVDEBUG_CONFIG_DEBUG=0")
+	}
+}
+
+func TestConfig_Explain(t *testing.T) {
+	lc := conf.Clone()
+	r := lc.Explain(nil, lc.FromEnv("MY_BLANK_ENV_VAR"), lc.FromFile("beta"), lc.Default(7))
+	expected := `1: missing
+2: empty, but used by ResolveString
+3: "42" (int64 from file key 'beta') <- selected
+4: "7", ignored
+`
+	if r != expected {
+		t.Errorf("Explain gave\n%s\nexpected\n%s", r, expected)
+	}
+	if r = lc.Explain(nil); r != "1: missing\nno value selected\n" {
+		t.Errorf("Explain gave %q for missing value", r)
+	}
+	if len(lc.Errors) != 0 {
+		t.Errorf("Explain appended errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_LoadReader(t *testing.T) {
+	lc := New("LoadReader")
+	if err := lc.LoadReader(strings.NewReader(TOML), "toml"); err != nil {
+		t.Fatalf("LoadReader gave error %v", err)
+	}
+	verify(t, "FromFile(alpha) after LoadReader", lc.FromFile("alpha"), "Some string")
+	if lc.LoadedFormat() != "toml" || lc.LoadedFile() != "" {
+		t.Errorf("LoadReader gave LoadedFormat %s and LoadedFile %s", lc.LoadedFormat(), lc.LoadedFile())
+	}
+	if err := lc.LoadReader(strings.NewReader("[server]\nport = 80\n"), "ini"); err != nil {
+		t.Fatalf("LoadReader gave error %v", err)
+	}
+	verify(t, "FromFile(server.port) after LoadReader", lc.FromFile("server.port"), "80")
+	if err := lc.LoadReader(strings.NewReader("{}"), "yaml"); err == nil || len(lc.Errors) != 1 {
+		t.Errorf("LoadReader accepted unsupported format")
+	}
+}
+
+// mapSource is a Source which looks values up in a map, and fails for the key "error".
+type mapSource map[string]string
+
+func (m mapSource) Lookup(key string) (*string, error) {
+	if key == "error" {
+		return nil, fmt.Errorf("lookup failed")
+	}
+	if v, ok := m[key]; ok {
+		return &v, nil
+	}
+	return nil, nil
+}
+
+func TestConfig_FromSource(t *testing.T) {
+	lc := New("FromSource")
+	src := mapSource{"db_password": "hunter2"}
+	verify(t, "FromSource(db_password)", lc.FromSource(src, "db_password"), "hunter2")
+	if lc.FromSource(src, "missing") != nil || len(lc.Errors) != 0 {
+		t.Errorf("FromSource(missing) gave non-nil or errors")
+	}
+	if lc.FromSource(src, "error") != nil || len(lc.Errors) != 1 {
+		t.Errorf("FromSource(error) gave non-nil or no error")
+	}
+}
+
+func TestConfig_UseEnvironmentFromEnv(t *testing.T) {
+	lc := conf.Clone()
+	lc.LookupEnv = fakeEnv(map[string]string{"APP_ENV": "production"})
+	lc.UseEnvironmentFromEnv("APP_ENV")
+	if lc.Environment != "production" {
+		t.Errorf("UseEnvironmentFromEnv set Environment %s, expected production", lc.Environment)
+	}
+	verify(t, "FromFile(alpha) with APP_ENV", lc.FromFile("alpha"), "Production string")
+	lc.UseEnvironmentFromEnv("UNSET_APP_ENV")
+	if lc.Environment != "development" {
+		t.Errorf("UseEnvironmentFromEnv set Environment %s, expected development", lc.Environment)
+	}
+}
+
+func TestConfig_LoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"defaults/config.toml": {Data: []byte("include = \"db.ini\"\nname = \"embedded\"\n")},
+		"defaults/db.ini":      {Data: []byte("[db]\nport = 5432\n")},
+	}
+	lc := New("LoadFS")
+	lc.LoadFS(fsys, "defaults/config.toml")
+	if len(lc.Errors) != 0 {
+		t.Fatalf("LoadFS gave errors %v", lc.Errors)
+	}
+	verify(t, "FromFile(name) after LoadFS", lc.FromFile("name"), "embedded")
+	verify(t, "FromFile(db.port) after LoadFS", lc.FromFile("db.port"), "5432")
+	lc.LoadFS(fsys, "missing.toml")
+	if len(lc.Errors) != 1 {
+		t.Errorf("LoadFS of missing file gave %d errors, expected 1", len(lc.Errors))
+	}
+}
+
+func TestConfig_originsReset(t *testing.T) {
+	lc := New("originsReset")
+	lc.EnvDebug = true
+	lc.LookupEnv = fakeEnv(map[string]string{"PORT": "80"})
+	for i := 0; i < 3; i++ {
+		if err := lc.LoadReader(strings.NewReader("port = 8080\n"), "toml"); err != nil {
+			t.Fatal(err)
+		}
+		lc.ResolveInt(lc.FromEnv("PORT"), lc.FromFile("port"))
+		lc.Sub("x").FromFile("port")
+	}
+	if len(lc.origins) != 1 || len(lc.envOrigins) != 1 {
+		t.Errorf("reloading left %d origins and %d env origins, expected 1 of each", len(lc.origins), len(lc.envOrigins))
+	}
+}
+
+func TestConfig_FromFileConcurrent(t *testing.T) {
+	lc := New("FromFileConcurrent")
+	lc.EnvDebug = true
+	lc.debugOut = ioutil.Discard
+	lc.LookupEnv = fakeEnv(map[string]string{"PORT": "x"})
+	if err := lc.LoadReader(strings.NewReader("port = 8080\nhost = \"localhost\"\n"), "toml"); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				if p := lc.ResolveIntNamed("port", lc.FromEnv("PORT"), lc.FromFile("port")); p != 8080 {
+					t.Errorf("ResolveIntNamed gave %d, expected 8080", p)
+					return
+				}
+				lc.ResolveString(lc.FromFile("host"))
+			}
+		}()
+	}
+	wg.Wait()
+	if len(lc.origins) != 2 || len(lc.envOrigins) != 1 {
+		t.Errorf("FromFile recorded %d origins and FromEnv %d, expected 2 and 1", len(lc.origins), len(lc.envOrigins))
+	}
+}
+
+func TestConfig_tables(t *testing.T) {
+	lc := conf.Clone()
+	verify(t, "FromFile(servers)", lc.FromFile("servers"), `[{"name":"one"},{"name":"two"}]`)
+	if len(lc.Errors) != 0 {
+		t.Fatalf("FromFile(servers) gave errors %v", lc.Errors)
+	}
+	if r := lc.ResolveString(lc.FromFile("database"), lc.Default("x")); r != "x" {
+		t.Errorf("ResolveString of table gave %s, expected default", r)
+	}
+	lc.ResolveInt(lc.FromFile("servers"))
+	if len(lc.Errors) != 3 {
+		t.Fatalf("Resolving tables as scalars gave %d errors, expected 3", len(lc.Errors))
+	}
+	for _, err := range lc.Errors[:2] {
+		if !strings.Contains(err.Error(), "is a table, not a scalar value") {
+			t.Errorf("Resolving table as scalar gave error %q", err)
+		}
+	}
+	lc.ClearErrors()
+	if re := lc.ResolveRegexp(lc.FromFile("database"), PS("^x$")); re == nil || re.String() != "^x$" {
+		t.Errorf("ResolveRegexp of table gave %v, expected default", re)
+	}
+	if p := lc.ResolvePath(lc.FromFile("servers"), PS("/tmp")); p != "/tmp" {
+		t.Errorf("ResolvePath of table gave %s, expected default", p)
+	}
+	if v, ok := Get[string](lc, "database"); ok {
+		t.Errorf("Get of table gave %q", v)
+	}
+	if len(lc.Errors) != 3 {
+		t.Fatalf("Resolving tables as scalars gave %d errors, expected 3: %v", len(lc.Errors), lc.Errors)
+	}
+	for _, err := range lc.Errors {
+		if !errors.Is(err, ErrInvalidValue) || !strings.Contains(err.Error(), "is a table, not a scalar value") {
+			t.Errorf("Resolving table as scalar gave error %q", err)
+		}
+	}
+}
+
+func TestConfig_FromEnvBase64(t *testing.T) {
+	lc := New("FromEnvBase64")
+	lc.LookupEnv = fakeEnv(map[string]string{
+		"STD":     "aGVsbG8/Pz4+\n",
+		"URLSAFE": "aGVsbG8_Pz4-",
+		"RAW":     "aGk",
+		"BAD":     "not base64!",
+	})
+	verify(t, "FromEnvBase64(STD)", lc.FromEnvBase64("STD"), "hello??>>")
+	verify(t, "FromEnvBase64(URLSAFE)", lc.FromEnvBase64("URLSAFE"), "hello??>>")
+	verify(t, "FromEnvBase64(RAW)", lc.FromEnvBase64("RAW"), "hi")
+	if lc.FromEnvBase64("UNSET") != nil || len(lc.Errors) != 0 {
+		t.Errorf("FromEnvBase64(UNSET) gave non-nil or errors")
+	}
+	if lc.FromEnvBase64("BAD") != nil || len(lc.Errors) != 1 {
+		t.Errorf("FromEnvBase64(BAD) gave non-nil or no error")
+	}
+}
+
+func TestConfig_RequireEnv(t *testing.T) {
+	lc := New("RequireEnv")
+	lc.LookupEnv = fakeEnv(testEnv)
+	if errs := lc.RequireEnv("MY_ENV_VAR"); errs != nil {
+		t.Errorf("RequireEnv gave errors %v for set variable", errs)
+	}
+	errs := lc.RequireEnv("MY_ENV_VAR", "MY_BLANK_ENV_VAR", "DATABASE_URL")
+	if len(errs) != 2 || len(lc.Errors) != 2 {
+		t.Fatalf("RequireEnv gave %d errors, expected 2", len(errs))
+	}
+	if !strings.Contains(errs[1].Error(), "DATABASE_URL") {
+		t.Errorf("RequireEnv error %q doesn't name variable", errs[1])
+	}
+}
+
+func TestConfig_TreatEmptyAsUnset(t *testing.T) {
+	lc := New("TreatEmptyAsUnset")
+	lc.LookupEnv = fakeEnv(testEnv)
+	list := []*string{lc.FromEnv("MY_BLANK_ENV_VAR"), lc.Default("7")}
+	if r := lc.ResolveString(list...); r != "" {
+		t.Errorf("ResolveString gave %q, expected empty string", r)
+	}
+	if r := lc.ResolveInt(list...); r != 7 {
+		t.Errorf("ResolveInt gave %d, expected 7", r)
+	}
+	lc.TreatEmptyAsUnset = true
+	if r := lc.ResolveString(list...); r != "7" {
+		t.Errorf("ResolveString gave %q with TreatEmptyAsUnset, expected 7", r)
+	}
+	if r := lc.ResolveStringPtr(list[0]); r != nil {
+		t.Errorf("ResolveStringPtr gave %q with TreatEmptyAsUnset, expected nil", *r)
+	}
+	if len(lc.Errors) != 0 {
+		t.Errorf("TreatEmptyAsUnset gave errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_ResolveHostPort(t *testing.T) {
+	lc := New("ResolveHostPort")
+	tests := []struct {
+		name      string
+		list      []*string
+		wantHost  string
+		wantPort  int
+		wantError bool
+	}{
+		{"bare port", []*string{PS(":8080")}, "", 8080, false},
+		{"host and port", []*string{PS("0.0.0.0:9000")}, "0.0.0.0", 9000, false},
+		{"ipv6", []*string{PS("[::1]:443")}, "::1", 443, false},
+		{"hostname", []*string{nil, PS("example.com:80")}, "example.com", 80, false},
+		{"no port", []*string{PS("localhost"), PS(":1")}, "", 1, true},
+		{"bad port", []*string{PS("localhost:http"), PS(":2")}, "", 2, true},
+		{"port too big", []*string{PS("localhost:65536"), PS(":3")}, "", 3, true},
+		{"missing", []*string{nil}, "", 0, true},
+	}
+	for _, tt := range tests {
+		lc.Errors = nil
+		h, p := lc.ResolveHostPort(tt.list...)
+		if h != tt.wantHost || p != tt.wantPort {
+			t.Errorf("%s: got %q, %d, expected %q, %d", tt.name, h, p, tt.wantHost, tt.wantPort)
+		}
+		if (len(lc.Errors) > 0) != tt.wantError {
+			t.Errorf("%s: unexpected errors %v", tt.name, lc.Errors)
+		}
+	}
+}
+
+func TestConfig_ResolvePair(t *testing.T) {
+	lc := New("ResolvePair")
+	tests := []struct {
+		name      string
+		list      []*string
+		wantA     float64
+		wantB     float64
+		wantError bool
+	}{
+		{"pair", []*string{PS("40.7128,-74.0060")}, 40.7128, -74.006, false},
+		{"spaces", []*string{nil, PS(" 1.5 , 2 ")}, 1.5, 2, false},
+		{"one part", []*string{PS("40.7128"), PS("1,2")}, 1, 2, true},
+		{"three parts", []*string{PS("1,2,3"), PS("3,4")}, 3, 4, true},
+		{"non-numeric", []*string{PS("north,west"), PS("5,6")}, 5, 6, true},
+		{"missing", []*string{nil}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		lc.ClearErrors()
+		a, b := lc.ResolvePair(",", tt.list...)
+		if a != tt.wantA || b != tt.wantB {
+			t.Errorf("%s: got %v, %v, expected %v, %v", tt.name, a, b, tt.wantA, tt.wantB)
+		}
+		if (len(lc.Errors) > 0) != tt.wantError {
+			t.Errorf("%s: unexpected errors %v", tt.name, lc.Errors)
+		}
+	}
+	lc.ClearErrors()
+	if a, b := lc.ResolvePair("x", PS("1920x1080")); a != 1920 || b != 1080 || len(lc.Errors) != 0 {
+		t.Errorf("ResolvePair with sep x gave %v, %v, errors %v", a, b, lc.Errors)
+	}
+	lat, long := lc.ResolveLatLong(PS("91,0"), PS("0,181"), PS("-33.8688,151.2093"))
+	if lat != -33.8688 || long != 151.2093 || len(lc.Errors) != 2 || !errors.Is(lc.Errors[0], ErrInvalidValue) {
+		t.Errorf("ResolveLatLong gave %v, %v, errors %v", lat, long, lc.Errors)
+	}
+}
+
+func TestConfig_ResolveStringCSV(t *testing.T) {
+	lc := conf.Clone()
+	tests := []struct {
+		name      string
+		list      []*string
+		want      []string
+		wantError bool
+	}{
+		{"quoted commas", []*string{PS(`"Smith, John","Doe, Jane"`)}, []string{"Smith, John", "Doe, Jane"}, false},
+		{"trimming", []*string{PS(` a , b,  "  c ", d`)}, []string{"a", "b", "  c ", "d"}, false},
+		{"empty last field", []*string{PS("a,")}, []string{"a", ""}, false},
+		{"empty last field after quotes", []*string{PS(`"a",`)}, []string{"a", ""}, false},
+		{"blank last field", []*string{PS("a, ")}, []string{"a", ""}, false},
+		{"file array", []*string{lc.FromFile("hosts")}, lc.ResolveStringSlice(",", lc.FromFile("hosts")), false},
+		{"unterminated quote", []*string{PS(`a,"b`), PS("x")}, []string{"x"}, true},
+		{"multiple lines", []*string{PS("a\nb"), PS("y")}, []string{"y"}, true},
+		{"missing", []*string{nil, PS(" ")}, nil, true},
+	}
+	for _, tt := range tests {
+		lc.ClearErrors()
+		got := lc.ResolveStringCSV(tt.list...)
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+			t.Errorf("%s: got %q, expected %q", tt.name, got, tt.want)
+		}
+		if (len(lc.Errors) > 0) != tt.wantError {
+			t.Errorf("%s: unexpected errors %v", tt.name, lc.Errors)
+		}
+	}
+}
+
+func TestConfig_SortedErrors(t *testing.T) {
+	lc := New("SortedErrors")
+	sub := lc.Sub("database")
+	sub.ResolveInt(PS("x"))
+	sub.ResolveBool(nil)
+	lc.ResolveInt(PS("x"))
+	if len(lc.Errors) != 5 {
+		t.Fatalf("expected 5 errors, got %v", lc.Errors)
+	}
+	errs := sub.UniqueErrors()
+	if len(errs) != 3 || errs[0] != lc.Errors[0] || errs[1] != lc.Errors[1] || errs[2] != lc.Errors[2] {
+		t.Errorf("UniqueErrors gave %v", errs)
+	}
+	errs = lc.SortedErrors()
+	if len(errs) != 3 || errs[0] != lc.Errors[2] || errs[1] != lc.Errors[1] || errs[2] != lc.Errors[0] {
+		t.Errorf("SortedErrors gave %v", errs)
+	}
+	if len(lc.Errors) != 5 {
+		t.Errorf("SortedErrors changed Errors to %v", lc.Errors)
+	}
+	if errs = New("SortedErrors").SortedErrors(); errs != nil {
+		t.Errorf("SortedErrors gave %v with no errors", errs)
+	}
+}
+
+func TestConfig_ClearErrors(t *testing.T) {
+	lc := New("ClearErrors")
+	sub := lc.Sub("database")
+	sub.ResolveInt(nil)
+	if len(lc.Errors) != 1 {
+		t.Fatalf("expected 1 error, got %v", lc.Errors)
+	}
+	sub.ClearErrors()
+	if len(lc.Errors) != 0 {
+		t.Errorf("ClearErrors on sub-config left errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_FromEnvAlias(t *testing.T) {
+	lc := New("FromEnvAlias")
+	lc.LookupEnv = fakeEnv(map[string]string{"NEW_NAME": "new", "OLD_NAME": "old", "OLDER_NAME": "older"})
+	verify(t, "current set", lc.FromEnvAlias("NEW_NAME", "OLD_NAME"), "new")
+	if lc.HasWarnings() {
+		t.Errorf("unexpected warnings %v", lc.Warnings)
+	}
+	verify(t, "deprecated set", lc.FromEnvAlias("UNSET_NAME", "MISSING_NAME", "OLDER_NAME"), "older")
+	if !lc.Sub("db").HasWarnings() {
+		t.Errorf("HasWarnings on sub-config didn't see parent's warnings")
+	}
+	if len(lc.Warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %v", lc.Warnings)
+	}
+	w := lc.Warnings[0].Error()
+	if !strings.Contains(w, "OLDER_NAME") || !strings.Contains(w, "UNSET_NAME") {
+		t.Errorf("warning %q doesn't name both variables", w)
+	}
+	if v := lc.FromEnvAlias("UNSET_NAME", "MISSING_NAME"); v != nil {
+		t.Errorf("expected nil, got %q", *v)
+	}
+	if len(lc.Errors) != 0 {
+		t.Errorf("unexpected errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_MaxErrors(t *testing.T) {
+	lc := New("MaxErrors")
+	var streamed []error
+	lc.MaxErrors = 2
+	lc.OnError = func(err error) { streamed = append(streamed, err) }
+	for i := 0; i < 5; i++ {
+		lc.ResolveInt(nil)
+	}
+	if len(lc.Errors) != 2 || lc.DroppedErrors != 3 {
+		t.Errorf("expected 2 errors and 3 dropped, got %d and %d", len(lc.Errors), lc.DroppedErrors)
+	}
+	if len(streamed) != 5 {
+		t.Errorf("expected 5 errors passed to OnError, got %d", len(streamed))
+	}
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("MustResolveInt didn't panic when its errors were dropped")
+			}
+		}()
+		lc.MustResolveInt(nil)
+	}()
+	lc.ClearErrors()
+	if len(lc.Errors) != 0 || lc.DroppedErrors != 0 {
+		t.Errorf("ClearErrors left %d errors and %d dropped", len(lc.Errors), lc.DroppedErrors)
+	}
+	lc.MaxErrors = -1
+	lc.ResolveInt(nil)
+	if len(lc.Errors) != 0 || lc.DroppedErrors != 1 {
+		t.Errorf("negative MaxErrors retained %d errors, dropped %d", len(lc.Errors), lc.DroppedErrors)
+	}
+}
+
+func TestConfig_FindAndLoadAll(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	system := filepath.Join(tmpdir, "system.toml")
+	user := filepath.Join(tmpdir, "user.ini")
+	local := filepath.Join(tmpdir, "local.toml")
+	if err = ioutil.WriteFile(system, []byte("name = \"system\"\nlevel = 1\n[db]\nhost = \"db.example.com\"\nport = 5432\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(user, []byte("level = 2\n[db]\nport = 5433\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lc := New("FindAndLoadAll")
+	loaded := lc.FindAndLoadAll(system, "", local, user)
+	if len(lc.Errors) != 0 {
+		t.Fatalf("FindAndLoadAll gave errors %v", lc.Errors)
+	}
+	if len(loaded) != 2 || loaded[0] != system || loaded[1] != user {
+		t.Errorf("FindAndLoadAll loaded %v, expected %s and %s", loaded, system, user)
+	}
+	verify(t, "FromFile(name)", lc.FromFile("name"), "system")
+	verify(t, "FromFile(level)", lc.FromFile("level"), "2")
+	verify(t, "FromFile(db.host)", lc.FromFile("db.host"), "db.example.com")
+	verify(t, "FromFile(db.port)", lc.FromFile("db.port"), "5433")
+	if lc.LoadedFile() != user || lc.LoadedFormat() != "ini" {
+		t.Errorf("LoadedFile gave %s (%s), expected %s", lc.LoadedFile(), lc.LoadedFormat(), user)
+	}
+	if loaded = lc.FindAndLoadAll(local); loaded != nil {
+		t.Errorf("FindAndLoadAll of missing file gave %v", loaded)
+	}
+	verify(t, "FromFile(name) after no files loaded", lc.FromFile("name"), "system")
+}
+
+func TestConfig_MergeKeepExisting(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	user := filepath.Join(tmpdir, "user.toml")
+	defaults := filepath.Join(tmpdir, "defaults.toml")
+	if err = ioutil.WriteFile(user, []byte("level = 2\n[db]\nport = 5433\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(defaults, []byte("level = 1\nname = \"defaults\"\n[db]\nhost = \"localhost\"\nport = 5432\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lc := New("MergeKeepExisting")
+	lc.MergeMode = MergeKeepExisting
+	lc.FindAndLoadAll(user, defaults)
+	if len(lc.Errors) != 0 {
+		t.Fatalf("FindAndLoadAll gave errors %v", lc.Errors)
+	}
+	verify(t, "FromFile(level)", lc.FromFile("level"), "2")
+	verify(t, "FromFile(name)", lc.FromFile("name"), "defaults")
+	verify(t, "FromFile(db.port)", lc.FromFile("db.port"), "5433")
+	verify(t, "FromFile(db.host)", lc.FromFile("db.host"), "localhost")
+}
+
+func TestConfig_CaseInsensitiveKeys(t *testing.T) {
+	lc := New("CaseInsensitiveKeys")
+	lc.Set("Port", int64(8080))
+	lc.Set("Database.Host", "db.example.com")
+	lc.Set("Mode", "a")
+	lc.Set("MODE", "b")
+	lc.Set("mode", "c")
+	lc.Set("Level", "x")
+	lc.Set("LEVEL", "y")
+	if lc.FromFile("port") != nil {
+		t.Errorf("FromFile(port) matched Port without CaseInsensitiveKeys")
+	}
+	lc.CaseInsensitiveKeys = true
+	verify(t, "FromFile(port)", lc.FromFile("port"), "8080")
+	verify(t, "FromFile(database.host)", lc.FromFile("database.host"), "db.example.com")
+	verify(t, "Sub(database).FromFile(HOST)", lc.Sub("DATABASE").FromFile("HOST"), "db.example.com")
+	verify(t, "FromFile(Mode)", lc.FromFile("Mode"), "a")
+	if lc.HasWarnings() {
+		t.Errorf("exact match gave warnings %v", lc.Warnings)
+	}
+	verify(t, "FromFile(level)", lc.FromFile("level"), "y")
+	verify(t, "FromFile(level) again", lc.FromFile("level"), "y")
+	if len(lc.Warnings) != 1 || !strings.Contains(lc.Warnings[0].Error(), "ambiguous") {
+		t.Errorf("ambiguous key gave warnings %v", lc.Warnings)
+	}
+	if lc.FromFile("port.number") != nil {
+		t.Errorf("FromFile(port.number) found a value inside a scalar")
+	}
+}
+
+func TestConfig_CaseInsensitiveKeysEnvironment(t *testing.T) {
+	lc := conf.Clone()
+	lc.CaseInsensitiveKeys = true
+	lc.Environment = "PRODUCTION"
+	verify(t, "FromFile(ALPHA)", lc.FromFile("ALPHA"), "Production string")
+	verify(t, "FromFile(Database.Host)", lc.FromFile("Database.Host"), "db.example.com")
+	verify(t, "FromFile(Database.Port)", lc.FromFile("Database.Port"), "5432")
+	if !lc.Has("Beta") {
+		t.Errorf("Has(Beta) gave false with CaseInsensitiveKeys")
+	}
+	if lc.HasWarnings() || len(lc.Errors) != 0 {
+		t.Errorf("unexpected warnings %v and errors %v", lc.Warnings, lc.Errors)
+	}
+}
+
+func TestConfig_ResolveFirst(t *testing.T) {
+	lc := New("ResolveFirst")
+	tests := []struct {
+		name      string
+		list      []*string
+		unset     bool
+		wantValue *string
+		wantIndex int
+	}{
+		{"first", []*string{PS("a"), PS("b")}, false, PS("a"), 0},
+		{"skip nil", []*string{nil, nil, PS("c")}, false, PS("c"), 2},
+		{"empty", []*string{nil, PS(""), PS("d")}, false, PS(""), 1},
+		{"empty as unset", []*string{nil, PS(""), PS("d")}, true, PS("d"), 2},
+		{"none", []*string{nil, nil}, false, nil, -1},
+		{"no list", nil, false, nil, -1},
+	}
+	for _, tt := range tests {
+		lc.TreatEmptyAsUnset = tt.unset
+		v, i := lc.ResolveFirst(tt.list...)
+		if i != tt.wantIndex || (v == nil) != (tt.wantValue == nil) || (v != nil && *v != *tt.wantValue) {
+			t.Errorf("%s: got %v, %d, expected %v, %d", tt.name, v, i, tt.wantValue, tt.wantIndex)
+		}
+		if v != nil && v != tt.list[i] {
+			t.Errorf("%s: returned pointer isn't the one from the list", tt.name)
+		}
+	}
+	if len(lc.Errors) != 0 {
+		t.Errorf("ResolveFirst gave errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_Alias(t *testing.T) {
+	lc := New("Alias")
+	lc.Set("dir", "/old")
+	lc.Set("cache_dir", "/cache")
+	lc.Set("old_cache", "/old_cache")
+	lc.Alias("dir", "base_dir")
+	lc.Alias("old_cache", "cache_dir")
+	verify(t, "FromFile(base_dir)", lc.FromFile("base_dir"), "/old")
+	if len(lc.Warnings) != 1 || !strings.Contains(lc.Warnings[0].Error(), "'dir' is deprecated, use 'base_dir'") {
+		t.Errorf("alias gave warnings %v", lc.Warnings)
+	}
+	verify(t, "FromFile(cache_dir)", lc.FromFile("cache_dir"), "/cache")
+	if len(lc.Warnings) != 1 {
+		t.Errorf("new key present gave warnings %v", lc.Warnings)
+	}
+	clone := lc.Clone()
+	clone.Set("base_dir", "/new")
+	verify(t, "clone FromFile(base_dir)", clone.FromFile("base_dir"), "/new")
+	if lc.FromFile("unaliased") != nil {
+		t.Errorf("FromFile(unaliased) gave a value")
+	}
+}
+
+func TestConfig_LoadMergeGlob(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	files := map[string]string{
+		"20-local.toml":    "level = 3\n",
+		"10-defaults.toml": "level = 1\nname = \"defaults\"\n",
+		"15-extra.toml":    "level = 2\n[extra]\nenabled = true\n",
+		"README":           "not a config file\n",
+	}
+	for name, data := range files {
+		if err = ioutil.WriteFile(filepath.Join(tmpdir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Mkdir(filepath.Join(tmpdir, "30-dir.toml"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	lc := New("LoadMergeGlob")
+	loaded := lc.LoadMergeGlob(filepath.Join(tmpdir, "*.toml"))
+	if len(lc.Errors) != 0 {
+		t.Fatalf("LoadMergeGlob gave errors %v", lc.Errors)
+	}
+	expected := []string{"10-defaults.toml", "15-extra.toml", "20-local.toml"}
+	if len(loaded) != len(expected) {
+		t.Fatalf("LoadMergeGlob loaded %v, expected %v", loaded, expected)
+	}
+	for i, fn := range loaded {
+		if filepath.Base(fn) != expected[i] {
+			t.Errorf("LoadMergeGlob loaded %v, expected %v", loaded, expected)
+			break
+		}
+	}
+	verify(t, "FromFile(level)", lc.FromFile("level"), "3")
+	verify(t, "FromFile(name)", lc.FromFile("name"), "defaults")
+	verify(t, "FromFile(extra.enabled)", lc.FromFile("extra.enabled"), "true")
+	if fs := lc.FindGlob("[bad"); fs != nil || len(lc.Errors) != 1 {
+		t.Errorf("FindGlob of bad pattern gave %v, errors %v", fs, lc.Errors)
+	}
+}
+
+func TestConfig_ResolveTimeZone(t *testing.T) {
+	lc := New("ResolveTimeZone")
+	tests := []struct {
+		name      string
+		list      []*string
+		want      string
+		wantError bool
+	}{
+		{"utc", []*string{PS("UTC")}, "UTC", false},
+		{"named", []*string{nil, PS("America/New_York")}, "America/New_York", false},
+		{"unknown", []*string{PS("Mars/Olympus_Mons"), PS("Europe/London")}, "Europe/London", true},
+		{"missing", []*string{nil, PS("")}, "UTC", true},
+	}
+	for _, tt := range tests {
+		lc.ClearErrors()
+		loc := lc.ResolveTimeZone(tt.list...)
+		if loc == nil || loc.String() != tt.want {
+			t.Errorf("%s: got %v, expected %s", tt.name, loc, tt.want)
+		}
+		if (len(lc.Errors) > 0) != tt.wantError {
+			t.Errorf("%s: unexpected errors %v", tt.name, lc.Errors)
+		}
+	}
+}
+
+func TestConfig_TreatEmptyEnvAsUnset(t *testing.T) {
+	lc := New("TreatEmptyEnvAsUnset")
+	lc.LookupEnv = fakeEnv(map[string]string{"BLANK": "", "SPACES": "  ", "SET": "x"})
+	if lc.ResolveString(lc.FromEnv("BLANK"), lc.Default("default")) != "" {
+		t.Errorf("blank variable didn't stop resolution by default")
+	}
+	lc.TreatEmptyEnvAsUnset = true
+	if r := lc.ResolveString(lc.FromEnv("BLANK"), lc.Default("default")); r != "default" {
+		t.Errorf("ResolveString gave %q with TreatEmptyEnvAsUnset, expected default", r)
+	}
+	verify(t, "FromEnv(SPACES)", lc.FromEnv("SPACES"), "  ")
+	verify(t, "FromEnv(SET)", lc.FromEnv("SET"), "x")
+	if lc.FromEnvBase64("BLANK") != nil {
+		t.Errorf("FromEnvBase64(BLANK) gave non-nil with TreatEmptyEnvAsUnset")
+	}
+	lc.TrimValues = true
+	if lc.FromEnv("SPACES") != nil {
+		t.Errorf("FromEnv(SPACES) gave non-nil with TrimValues and TreatEmptyEnvAsUnset")
+	}
+	if len(lc.Errors) != 0 {
+		t.Errorf("unexpected errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_LoadURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app.toml":
+			fmt.Fprint(w, "name = \"toml\"\n")
+		case "/app":
+			w.Header().Set("Content-Type", "text/x-ini")
+			fmt.Fprint(w, "[db]\nhost = ini.example.com\n")
+		case "/bad.toml":
+			fmt.Fprint(w, "name = \n")
+		case "/plain.toml":
+			w.Header().Set("Content-Type", "text/plain; profile=minimal")
+			fmt.Fprint(w, "name = \"plain\"\n")
+		case "/big.toml":
+			fmt.Fprintf(w, "name = \"%s\"\n", strings.Repeat("x", 100))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	lc := New("LoadURL")
+	if err := lc.LoadURL(context.Background(), srv.URL+"/app.toml"); err != nil {
+		t.Fatalf("LoadURL gave error %v", err)
+	}
+	verify(t, "FromFile(name)", lc.FromFile("name"), "toml")
+	if lc.LoadedFile() != srv.URL+"/app.toml" || lc.LoadedFormat() != "toml" {
+		t.Errorf("LoadedFile gave %s (%s)", lc.LoadedFile(), lc.LoadedFormat())
+	}
+	if err := lc.LoadURL(context.Background(), srv.URL+"/app"); err != nil {
+		t.Fatalf("LoadURL gave error %v", err)
+	}
+	verify(t, "FromFile(db.host)", lc.FromFile("db.host"), "ini.example.com")
+	if lc.LoadedFormat() != "ini" {
+		t.Errorf("LoadedFormat gave %s, expected ini", lc.LoadedFormat())
+	}
+	if err := lc.LoadURL(context.Background(), srv.URL+"/plain.toml"); err != nil {
+		t.Fatalf("LoadURL gave error %v", err)
+	}
+	if lc.LoadedFormat() != "toml" {
+		t.Errorf("LoadedFormat gave %s for text/plain, expected toml", lc.LoadedFormat())
+	}
+	defer func(n int) { maxURLSize = n }(maxURLSize)
+	maxURLSize = 100
+	for _, p := range []string{"/missing.toml", "/bad.toml", "/big.toml"} {
+		if err := lc.LoadURL(context.Background(), srv.URL+p); err == nil {
+			t.Errorf("LoadURL(%s) didn't return an error", p)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := lc.LoadURL(ctx, srv.URL+"/app.toml"); err == nil {
+		t.Errorf("LoadURL with cancelled context didn't return an error")
+	}
+	if len(lc.Errors) != 4 {
+		t.Errorf("expected 4 errors, got %v", lc.Errors)
+	}
+	verify(t, "FromFile(name) after failures", lc.FromFile("name"), "plain")
+}
+
+func TestConfig_FromEnvJSON(t *testing.T) {
+	lc := New("FromEnvJSON")
+	lc.LookupEnv = fakeEnv(map[string]string{
+		"ENDPOINTS": `["a", "b"]`,
+		"LIMITS":    `{"cpu": 2, "memory": 512}`,
+		"BROKEN":    `["a",`,
+	})
+	var endpoints []string
+	if err := lc.FromEnvJSON("ENDPOINTS", &endpoints); err != nil || len(endpoints) != 2 || endpoints[1] != "b" {
+		t.Errorf("FromEnvJSON(ENDPOINTS) gave %v, %v", endpoints, err)
+	}
+	var limits struct {
+		CPU    int `json:"cpu"`
+		Memory int `json:"memory"`
+	}
+	if err := lc.FromEnvJSON("LIMITS", &limits); err != nil || limits.CPU != 2 || limits.Memory != 512 {
+		t.Errorf("FromEnvJSON(LIMITS) gave %+v, %v", limits, err)
+	}
+	unset := []string{"default"}
+	if err := lc.FromEnvJSON("UNSET", &unset); err != nil || len(unset) != 1 {
+		t.Errorf("FromEnvJSON(UNSET) gave %v, %v", unset, err)
+	}
+	if len(lc.Errors) != 0 {
+		t.Fatalf("unexpected errors %v", lc.Errors)
+	}
+	if err := lc.FromEnvJSON("BROKEN", &endpoints); err == nil || len(lc.Errors) != 1 {
+		t.Errorf("FromEnvJSON(BROKEN) gave %v, errors %v", err, lc.Errors)
+	}
+}
+
+func TestConfig_ResolveStringNonEmpty(t *testing.T) {
+	lc := New("ResolveStringNonEmpty")
+	list := []*string{nil, PS(""), PS("42")}
+	if r := lc.ResolveString(list...); r != "" {
+		t.Errorf("ResolveString gave %q, expected the empty value to win", r)
+	}
+	if r := lc.ResolveInt(list...); r != 42 {
+		t.Errorf("ResolveInt gave %d, expected the empty value to be skipped", r)
+	}
+	if r := lc.ResolveStringNonEmpty(list...); r != "42" {
+		t.Errorf("ResolveStringNonEmpty gave %q, expected 42", r)
+	}
+	if len(lc.Errors) != 0 {
+		t.Fatalf("unexpected errors %v", lc.Errors)
+	}
+	if r := lc.ResolveStringNonEmpty(nil, PS("")); r != "" || len(lc.Errors) != 1 {
+		t.Errorf("ResolveStringNonEmpty of empty values gave %q, errors %v", r, lc.Errors)
+	}
+}
+
+func TestConfig_ResolveStringTrimmed(t *testing.T) {
+	lc := conf.Clone()
+	if r := lc.ResolveStringTrimmed(nil, PS("s3cr3t\n"), PS("x")); r != "s3cr3t" {
+		t.Errorf("ResolveStringTrimmed gave %q, expected s3cr3t", r)
+	}
+	if r := lc.ResolveStringTrimmed(PS(" \t"), PS("x")); r != "" {
+		t.Errorf("ResolveStringTrimmed gave %q, expected the blank value to win", r)
+	}
+	lc.TreatEmptyAsUnset = true
+	if r := lc.ResolveStringTrimmed(PS(" \t"), lc.FromFile("alpha")); r != "Some string" {
+		t.Errorf("ResolveStringTrimmed gave %q with TreatEmptyAsUnset, expected the blank value to be skipped", r)
+	}
+	if len(lc.Errors) != 0 {
+		t.Fatalf("unexpected errors %v", lc.Errors)
+	}
+	if r := lc.ResolveStringTrimmed(lc.FromFile("database"), PS(" y ")); r != "y" || len(lc.Errors) != 1 {
+		t.Errorf("ResolveStringTrimmed gave %q, errors %v, expected the table to be rejected", r, lc.Errors)
+	}
+}
+
+func TestConfig_ResolveUnderscores(t *testing.T) {
+	lc := New("ResolveUnderscores")
+	lc.LookupEnv = fakeEnv(map[string]string{"BIG_NUMBER": "1_000_000"})
+	lc.Set("big_number", int64(1_000_000))
+	env, file := lc.FromEnv("BIG_NUMBER"), lc.FromFile("big_number")
+	for _, elem := range []*string{env, file} {
+		if n := lc.ResolveInt(elem); n != 1000000 {
+			t.Errorf("ResolveInt(%s) gave %d", *elem, n)
+		}
+		if n := lc.ResolveInt64(elem); n != 1000000 {
+			t.Errorf("ResolveInt64(%s) gave %d", *elem, n)
+		}
+		if f := lc.ResolveFloat64(elem); f != 1e6 {
+			t.Errorf("ResolveFloat64(%s) gave %v", *elem, f)
+		}
+	}
+	if f := lc.ResolveFloat64(PS("1_000.000_5")); f != 1000.0005 {
+		t.Errorf("ResolveFloat64(1_000.000_5) gave %v", f)
+	}
+	if len(lc.Errors) != 0 {
+		t.Fatalf("unexpected errors %v", lc.Errors)
+	}
+	for _, bad := range []string{"_1000", "1000_", "1__000"} {
+		lc.ClearErrors()
+		if n := lc.ResolveInt64(PS(bad), PS("7")); n != 7 || len(lc.Errors) != 1 {
+			t.Errorf("ResolveInt64(%s) gave %d, errors %v", bad, n, lc.Errors)
+		}
+		lc.ClearErrors()
+		if f := lc.ResolveFloat64(PS(bad), PS("7")); f != 7 || len(lc.Errors) != 1 {
+			t.Errorf("ResolveFloat64(%s) gave %v, errors %v", bad, f, lc.Errors)
+		}
+	}
+	lc.ClearErrors()
+	if n := lc.ResolveInt64(PS("9007199254740993")); n != 9007199254740993 {
+		t.Errorf("ResolveInt64 gave %d for a large value", n)
+	}
+	if lc.ResolveInt64(nil); len(lc.Errors) != 1 || !errors.Is(lc.Errors[0], ErrMissingValue) {
+		t.Errorf("ResolveInt64 of missing value gave errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_ResolvePath(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	fn := filepath.Join(tmpdir, "app.toml")
+	data := "cert_file = \"certs/server.pem\"\nkey_file = \"/etc/ssl/server.key\"\n[tls]\nca_file = \"ca.pem\"\n"
+	if err = ioutil.WriteFile(fn, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lc := New("ResolvePath")
+	lc.Load(fn)
+	tests := []struct {
+		name string
+		list []*string
+		want string
+	}{
+		{"relative from file", []*string{nil, lc.FromFile("cert_file")}, filepath.Join(tmpdir, "certs", "server.pem")},
+		{"absolute from file", []*string{lc.FromFile("key_file")}, "/etc/ssl/server.key"},
+		{"relative from flag", []*string{PS("local.pem"), lc.FromFile("cert_file")}, "local.pem"},
+		{"sub-config", []*string{lc.Sub("tls").FromFile("ca_file")}, filepath.Join(tmpdir, "ca.pem")},
+	}
+	for _, tt := range tests {
+		if r := lc.ResolvePath(tt.list...); r != tt.want {
+			t.Errorf("%s: got %s, expected %s", tt.name, r, tt.want)
+		}
+	}
+	if len(lc.Errors) != 0 {
+		t.Fatalf("unexpected errors %v", lc.Errors)
+	}
+	files := map[string]string{
+		"main.toml":      "include = \"inc/extra.toml\"\ncert_file = \"main.pem\"\n",
+		"inc/extra.toml": "cert_file = \"extra.pem\"\nca_file = \"ca.pem\"\n",
+		"d/a/merge.toml": "cert_file = \"a.pem\"\nca_file = \"ca.pem\"\n",
+		"d/b/merge.toml": "cert_file = \"b.pem\"\n",
+	}
+	for name, text := range files {
+		name = filepath.Join(tmpdir, name)
+		if err = os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(name, []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lc.Load(filepath.Join(tmpdir, "main.toml"))
+	if r := lc.ResolvePath(lc.FromFile("cert_file")); r != filepath.Join(tmpdir, "main.pem") {
+		t.Errorf("path from including file gave %s", r)
+	}
+	if r := lc.ResolvePath(lc.FromFile("ca_file")); r != filepath.Join(tmpdir, "inc", "ca.pem") {
+		t.Errorf("path from included file gave %s", r)
+	}
+	lc.LoadMergeGlob(filepath.Join(tmpdir, "d", "*", "merge.toml"))
+	if r := lc.ResolvePath(lc.FromFile("cert_file")); r != filepath.Join(tmpdir, "d", "b", "b.pem") {
+		t.Errorf("path from later merged file gave %s", r)
+	}
+	if r := lc.ResolvePath(lc.FromFile("ca_file")); r != filepath.Join(tmpdir, "d", "a", "ca.pem") {
+		t.Errorf("path from earlier merged file gave %s", r)
+	}
+	if len(lc.Errors) != 0 {
+		t.Fatalf("unexpected errors %v", lc.Errors)
+	}
+	lc.LoadReader(strings.NewReader(data), "toml")
+	if r := lc.ResolvePath(lc.FromFile("cert_file")); r != "certs/server.pem" {
+		t.Errorf("path from reader gave %s, expected it unchanged", r)
+	}
+}
+
+func TestConfig_Keys(t *testing.T) {
+	expected := []string{"alpha", "beta", "database.host", "database.port", "delta", "factors", "gamma",
+		"headers.Accept", "headers.X-Api-Key", "hosts", "next_run", "production.alpha",
+		"production.database.host", "run_at", "servers", "start_date", "updated", "weights"}
+	keys := conf.Keys()
+	if strings.Join(keys, " ") != strings.Join(expected, " ") {
+		t.Errorf("Keys gave %v, expected %v", keys, expected)
+	}
+	if keys = New("Keys").Keys(); keys == nil || len(keys) != 0 {
+		t.Errorf("Keys with no file loaded gave %#v", keys)
+	}
+}
+
+func TestConfig_ResolveRegexp(t *testing.T) {
+	lc := New("ResolveRegexp")
+	tests := []struct {
+		name      string
+		list      []*string
+		want      string
+		wantError bool
+	}{
+		{"valid", []*string{nil, PS("^/health")}, "^/health", false},
+		{"invalid", []*string{PS("^/(health"), PS("^/status$")}, "^/status$", true},
+		{"missing", []*string{nil, PS("")}, "", true},
+	}
+	for _, tt := range tests {
+		lc.ClearErrors()
+		re := lc.ResolveRegexp(tt.list...)
+		if (re == nil && tt.want != "") || (re != nil && re.String() != tt.want) {
+			t.Errorf("%s: got %v, expected %s", tt.name, re, tt.want)
+		}
+		if (len(lc.Errors) > 0) != tt.wantError {
+			t.Errorf("%s: unexpected errors %v", tt.name, lc.Errors)
+		}
+	}
+	lc.ClearErrors()
+	lc.ResolveRegexp(PS("a[b"))
+	if len(lc.Errors) != 2 || !strings.Contains(lc.Errors[0].Error(), "'a[b'") {
+		t.Errorf("invalid pattern gave errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_ResolveEnumInt(t *testing.T) {
+	lc := New("ResolveEnumInt")
+	if r := lc.ResolveEnumInt([]int{1, 2, 4}, PS("3"), PS("4")); r != 4 {
+		t.Errorf("ResolveEnumInt gave %d, expected 4", r)
+	}
+	if len(lc.Errors) != 1 || !strings.Contains(lc.Errors[0].Error(), "expected one of: 1, 2, 4") {
+		t.Errorf("ResolveEnumInt gave errors %v", lc.Errors)
+	}
+	names := map[int]string{0: "off", 1: "on", 2: "auto"}
+	tests := []struct {
+		name      string
+		list      []*string
+		want      int
+		wantError bool
+	}{
+		{"number", []*string{nil, PS("2")}, 2, false},
+		{"name", []*string{PS("Auto")}, 2, false},
+		{"out of range", []*string{PS("5"), PS("1")}, 1, true},
+		{"unknown name", []*string{PS("sometimes"), PS("off")}, 0, true},
+		{"fraction", []*string{PS("1.9"), PS("2")}, 2, true},
+		{"missing", []*string{nil}, 0, true},
+	}
+	for _, tt := range tests {
+		lc.ClearErrors()
+		if r := lc.ResolveEnumIntWithNames(names, tt.list...); r != tt.want {
+			t.Errorf("%s: got %d, expected %d", tt.name, r, tt.want)
+		}
+		if (len(lc.Errors) > 0) != tt.wantError {
+			t.Errorf("%s: unexpected errors %v", tt.name, lc.Errors)
+		}
+	}
+	lc.ClearErrors()
+	lc.ResolveEnumIntWithNames(names, PS("5"))
+	if len(lc.Errors) == 0 || !strings.HasSuffix(lc.Errors[0].Error(), "expected one of: off(0), on(1), auto(2)") {
+		t.Errorf("ResolveEnumIntWithNames gave errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_EnvKey(t *testing.T) {
+	lc := New("myapp")
+	lc.LookupEnv = fakeEnv(map[string]string{"MYAPP_DB_HOST": "db.example.com", "DB_PORT": "5433"})
+	tests := []struct {
+		cfg  *Config
+		key  string
+		want string
+	}{
+		{lc, "db.host", "MYAPP_DB_HOST"},
+		{lc, "log-level", "MYAPP_LOG_LEVEL"},
+		{lc.Sub("db"), "host", "MYAPP_DB_HOST"},
+		{lc.Sub("db").Sub("replica"), "host", "MYAPP_DB_REPLICA_HOST"},
+	}
+	for _, tt := range tests {
+		if r := tt.cfg.EnvKey(tt.key); r != tt.want {
+			t.Errorf("EnvKey(%s) gave %s, expected %s", tt.key, r, tt.want)
+		}
+	}
+	verify(t, "FromDerivedEnv(db.host)", lc.FromDerivedEnv("db.host"), "db.example.com")
+	verify(t, "Sub(db).FromDerivedEnv(host)", lc.Sub("db").FromDerivedEnv("host"), "db.example.com")
+	lc.EnvKeyNoPrefix = true
+	if r := lc.EnvKey("db.port"); r != "DB_PORT" {
+		t.Errorf("EnvKey(db.port) with EnvKeyNoPrefix gave %s", r)
+	}
+	verify(t, "FromDerivedEnv(db.port)", lc.FromDerivedEnv("db.port"), "5433")
+}
+
+func TestConfig_Value(t *testing.T) {
+	lc := conf.Clone()
+	lc.EnvPrefix = "APP_"
+	lc.LookupEnv = fakeEnv(map[string]string{"APP_DATABASE_HOST": "env.example.com", "MYAPPNAME_ALPHA": "unused"})
+	if r := lc.EnvKey("database.host"); r != "APP_DATABASE_HOST" {
+		t.Errorf("EnvKey with EnvPrefix gave %s", r)
+	}
+	verify(t, "Value(database.host)", lc.Value("database.host"), "env.example.com")
+	verify(t, "Value(alpha)", lc.Value("alpha"), "Some string")
+	if r := lc.ResolveInt(lc.Sub("database").Value("port"), lc.Default(1)); r != 5432 {
+		t.Errorf("ResolveInt of Value(port) gave %d, expected 5432", r)
+	}
+	if lc.Value("missing") != nil {
+		t.Errorf("Value(missing) gave a value")
+	}
+}
+
+func TestConfig_ResolveFloatLocale(t *testing.T) {
+	lc := New("ResolveFloatLocale")
+	tests := []struct {
+		input     string
+		want      float64
+		wantError bool
+	}{
+		{"1,234.56", 1234.56, false},
+		{"1,000,000", 1e6, false},
+		{"10%", 0.1, false},
+		{" 150 % ", 1.5, false},
+		{"-2.5", -2.5, false},
+		{"1.2.3", 0, true},
+		{"ten", 0, true},
+		{"nan", 0, true},
+		{"inf%", 0, true},
+	}
+	for _, tt := range tests {
+		lc.ClearErrors()
+		if r := lc.ResolveFloatLocale(PS(tt.input)); math.Abs(r-tt.want) > 1e-9 {
+			t.Errorf("ResolveFloatLocale(%s) gave %v, expected %v", tt.input, r, tt.want)
+		}
+		if (len(lc.Errors) > 0) != tt.wantError {
+			t.Errorf("ResolveFloatLocale(%s) gave errors %v", tt.input, lc.Errors)
+		}
+	}
+	lc.ClearErrors()
+	lc.GroupSeparators = ". "
+	lc.DecimalSeparator = ","
+	if r := lc.ResolveFloatLocale(PS("1.234.567,5")); r != 1234567.5 {
+		t.Errorf("ResolveFloatLocale with German separators gave %v", r)
+	}
+	if r := lc.ResolveFloatLocale(PS("1 234,5%")); math.Abs(r-12.345) > 1e-9 {
+		t.Errorf("ResolveFloatLocale with space separator gave %v", r)
+	}
+	if len(lc.Errors) != 0 {
+		t.Errorf("unexpected errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_ResolveFileMode(t *testing.T) {
+	lc := New("ResolveFileMode")
+	src := "perm = 0o755\nsticky = 0o1777\ndecimal = 644\nreadonly = 400\nprivate = 600\nsmall = 7\n"
+	if err := lc.LoadReader(strings.NewReader(src), "toml"); err != nil {
+		t.Fatal(err)
+	}
+	lc.Set("set", int64(644))
+	tests := []struct {
+		name      string
+		list      []*string
+		want      os.FileMode
+		wantError bool
+	}{
+		{"leading zero", []*string{PS("0644")}, 0644, false},
+		{"0o prefix", []*string{PS("0o755")}, 0755, false},
+		{"no prefix", []*string{nil, PS("600")}, 0600, false},
+		{"sticky", []*string{PS("1777")}, 01777, false},
+		{"file integer", []*string{lc.FromFile("perm")}, 0755, false},
+		{"file integer sticky", []*string{lc.FromFile("sticky")}, 01777, false},
+		{"decimal file integer", []*string{lc.FromFile("decimal"), PS("0600")}, 0600, true},
+		{"decimal file integer 400", []*string{lc.FromFile("readonly"), PS("0600")}, 0600, true},
+		{"decimal file integer 600", []*string{lc.FromFile("private"), PS("0640")}, 0640, true},
+		{"decimal file integer same as octal", []*string{lc.FromFile("small")}, 07, false},
+		{"set integer", []*string{lc.FromFile("set")}, 01204, false},
+		{"not octal", []*string{PS("0689"), PS("0640")}, 0640, true},
+		{"too big", []*string{PS("17777"), PS("0o700")}, 0700, true},
+		{"missing", []*string{nil}, 0, true},
+	}
+	for _, tt := range tests {
+		lc.ClearErrors()
+		if r := lc.ResolveFileMode(tt.list...); r != tt.want {
+			t.Errorf("%s: got %o, expected %o", tt.name, r, tt.want)
+		}
+		if (len(lc.Errors) > 0) != tt.wantError {
+			t.Errorf("%s: unexpected errors %v", tt.name, lc.Errors)
+		}
+	}
+	lc.ClearErrors()
+	lc.ResolveFileMode(lc.FromFile("decimal"))
+	if len(lc.Errors) == 0 || !strings.Contains(lc.Errors[0].Error(), `write it as 0o644 or "0644"`) {
+		t.Errorf("decimal file integer gave errors %v", lc.Errors)
+	}
+	lc.ClearErrors()
+	if err := lc.LoadReader(strings.NewReader(`{"perm": 400}`), "json"); err != nil {
+		t.Fatal(err)
+	}
+	if r := lc.ResolveFileMode(lc.FromFile("perm")); r != 0 || len(lc.Errors) == 0 {
+		t.Errorf("decimal JSON integer: got %o with errors %v", r, lc.Errors)
+	}
+}
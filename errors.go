@@ -0,0 +1,66 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// Sentinel errors which the errors appended to Config.Errors can be checked against with errors.Is.
+var (
+	// ErrMissingValue means that none of the possible values for a setting were present.
+	ErrMissingValue = errors.New("missing value")
+	// ErrParse means that a value couldn't be parsed as the type being resolved.
+	ErrParse = errors.New("unrecognized value")
+	// ErrInvalidValue means that a value was parsed, but wasn't acceptable, for example because it was
+	// out of range or was a table rather than a scalar value.
+	ErrInvalidValue = errors.New("invalid value")
+	// ErrUnknownKey means that the config file has a key which doesn't correspond to any field of the
+	// struct being populated, when Config.Strict is set.
+	ErrUnknownKey = errors.New("unknown key")
+	// ErrFileNotFound means that a config file didn't exist. It's the same as fs.ErrNotExist, so errors
+	// from the os package also match it.
+	ErrFileNotFound = fs.ErrNotExist
+)
+
+// ValueError describes a problem with a configuration value. Use errors.As to get one from an error in
+// Config.Errors, and errors.Is to check its kind against ErrMissingValue, ErrParse, ErrInvalidValue or
+// ErrUnknownKey.
+type ValueError struct {
+	Key    string // The file key the value came from, or the name given to a Named resolver, if known
+	Source string // Where the value came from, such as "file", if known
+	Value  string // The offending value, if there was one
+	Err    error  // The underlying error, which gives the full description
+	kind   error
+}
+
+// Error returns the description of the underlying error.
+func (e *ValueError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error, such as a *strconv.NumError.
+func (e *ValueError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error is of the kind given by one of the sentinel errors.
+func (e *ValueError) Is(target error) bool {
+	return target == e.kind
+}
+
+// missingError returns an ErrMissingValue error saying that no value of the described type was found.
+func missingError(kind string) *ValueError {
+	return &ValueError{Err: fmt.Errorf("missing default %s value", kind), kind: ErrMissingValue}
+}
+
+// valueError returns an error of the given kind about a value passed to a resolver, noting the file
+// key it came from if it came from the config file.
+func (c *Config) valueError(elem *string, kind error, err error) *ValueError {
+	ve := &ValueError{Value: *elem, Err: err, kind: kind}
+	if fv, ok := c.fileOrigin(elem); ok {
+		ve.Key = fv.key
+		ve.Source = "file"
+	}
+	return ve
+}
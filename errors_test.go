@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestConfig_ErrorTypes(t *testing.T) {
+	lc := conf.Clone()
+	lc.ResolveInt(lc.FromFile("alpha"))
+	if len(lc.Errors) != 2 {
+		t.Fatalf("expected 2 errors, got %v", lc.Errors)
+	}
+	parseErr, missingErr := lc.Errors[0], lc.Errors[1]
+	if !errors.Is(parseErr, ErrParse) || errors.Is(parseErr, ErrMissingValue) {
+		t.Errorf("parse error %v doesn't match ErrParse only", parseErr)
+	}
+	var ve *ValueError
+	if !errors.As(parseErr, &ve) || ve.Key != "alpha" || ve.Source != "file" || ve.Value != "Some string" {
+		t.Errorf("parse error gave ValueError %+v", ve)
+	}
+	var ne *strconv.NumError
+	if !errors.As(parseErr, &ne) {
+		t.Errorf("parse error %v doesn't wrap *strconv.NumError", parseErr)
+	}
+	if !errors.Is(missingErr, ErrMissingValue) || errors.Is(missingErr, ErrParse) {
+		t.Errorf("missing error %v doesn't match ErrMissingValue only", missingErr)
+	}
+
+	lc.ClearErrors()
+	lc.ResolveDurationRange(0, 0, PS("-1s"))
+	if !errors.Is(lc.Errors[0], ErrInvalidValue) {
+		t.Errorf("out of range error %v doesn't match ErrInvalidValue", lc.Errors[0])
+	}
+
+	lc.ClearErrors()
+	lc.ResolveIntNamed("server.port", nil)
+	if !errors.As(lc.Errors[0], &ve) || ve.Key != "server.port" || !errors.Is(lc.Errors[0], ErrMissingValue) {
+		t.Errorf("named error %v gave ValueError %+v", lc.Errors[0], ve)
+	}
+
+	lc.ClearErrors()
+	lc.Load(os.TempDir() + "non_existent_file.toml")
+	lc.LookupEnv = fakeEnv(map[string]string{"MYAPP_CONFIG": os.TempDir() + "non_existent_file.toml"})
+	lc.FileFromEnv("MYAPP_CONFIG")
+	for _, err := range lc.Errors {
+		if !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("error %v doesn't match ErrFileNotFound", err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NamedSource is a possible value for a setting together with a description of where it came from,
+// such as the environment variable name, for use with ExplainSources.
+type NamedSource struct {
+	Name  string
+	Value *string
+}
+
+// EnvSource looks up an environment variable as for FromEnv, and names the result after the variable.
+func (c *Config) EnvSource(key string) NamedSource {
+	return NamedSource{Name: "env " + key, Value: c.FromEnv(key)}
+}
+
+// FileSource looks up a key in the config file as for FromFile, and names the result after the key.
+func (c *Config) FileSource(key string) NamedSource {
+	return NamedSource{Name: "file " + c.keyPrefix + key, Value: c.FromFile(key)}
+}
+
+// SourceExplanation describes one of the sources consulted by ExplainSources.
+type SourceExplanation struct {
+	Name     string // Name of the source
+	Present  bool   // Whether the source had a value, possibly empty
+	Value    string // The source's value, if it had one
+	Selected bool   // Whether this is the value the setting resolves to
+}
+
+// Explanation describes how a setting resolves, as returned by ExplainSources.
+type Explanation struct {
+	Key      string
+	Sources  []SourceExplanation
+	Selected int // Index in Sources of the selected value, or -1 if no source had a value
+}
+
+// ExplainSources describes how the setting with the given key would be resolved from the sources, as
+// structured data suitable for a `config explain` command. As with Explain, the value selected is the
+// first which is non-missing and non-empty, and nothing is appended to Config.Errors. For example:
+//
+//	e := conf.ExplainSources("port", conf.EnvSource("PORT"), conf.FileSource("server.port"),
+//		config.NamedSource{Name: "default", Value: conf.Default(8080)})
+//	fmt.Print(e)
+func (c *Config) ExplainSources(key string, sources ...NamedSource) Explanation {
+	e := Explanation{Key: key, Sources: make([]SourceExplanation, len(sources)), Selected: -1}
+	for i, src := range sources {
+		se := SourceExplanation{Name: src.Name, Present: src.Value != nil}
+		if se.Present {
+			se.Value = *src.Value
+		}
+		if e.Selected < 0 && se.Value != "" {
+			se.Selected = true
+			e.Selected = i
+		}
+		e.Sources[i] = se
+	}
+	return e
+}
+
+// Value returns the selected value, and whether there was one.
+func (e Explanation) Value() (string, bool) {
+	if e.Selected < 0 {
+		return "", false
+	}
+	return e.Sources[e.Selected].Value, true
+}
+
+// String formats the explanation with one line per source.
+func (e Explanation) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s:\n", e.Key)
+	for _, se := range e.Sources {
+		switch {
+		case !se.Present:
+			fmt.Fprintf(&sb, "  %s: missing\n", se.Name)
+		case se.Selected:
+			fmt.Fprintf(&sb, "  %s: %q <- selected\n", se.Name, se.Value)
+		case se.Value == "":
+			fmt.Fprintf(&sb, "  %s: empty\n", se.Name)
+		default:
+			fmt.Fprintf(&sb, "  %s: %q, ignored\n", se.Name, se.Value)
+		}
+	}
+	if e.Selected < 0 {
+		sb.WriteString("  no value selected\n")
+	}
+	return sb.String()
+}
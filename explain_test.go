@@ -0,0 +1,35 @@
+package config
+
+import "testing"
+
+func TestConfig_ExplainSources(t *testing.T) {
+	lc := conf.Clone()
+	lc.LookupEnv = fakeEnv(map[string]string{"DB_PORT": ""})
+	e := lc.ExplainSources("port", lc.EnvSource("PORT"), lc.EnvSource("DB_PORT"), lc.Sub("database").FileSource("port"),
+		NamedSource{Name: "default", Value: lc.Default(8080)})
+	if e.Selected != 2 || len(e.Sources) != 4 {
+		t.Fatalf("ExplainSources gave %+v", e)
+	}
+	if e.Sources[0].Present || !e.Sources[1].Present || e.Sources[1].Selected || !e.Sources[2].Selected {
+		t.Errorf("ExplainSources gave sources %+v", e.Sources)
+	}
+	if v, ok := e.Value(); !ok || v != "5432" {
+		t.Errorf("ExplainSources gave value %q, %v", v, ok)
+	}
+	expected := `port:
+  env PORT: missing
+  env DB_PORT: empty
+  file database.port: "5432" <- selected
+  default: "8080", ignored
+`
+	if e.String() != expected {
+		t.Errorf("ExplainSources gave\n%s\nexpected\n%s", e, expected)
+	}
+	e = lc.ExplainSources("x", lc.EnvSource("PORT"))
+	if _, ok := e.Value(); ok || e.String() != "x:\n  env PORT: missing\n  no value selected\n" {
+		t.Errorf("ExplainSources gave %q for missing value", e)
+	}
+	if len(lc.Errors) != 0 {
+		t.Errorf("ExplainSources appended errors %v", lc.Errors)
+	}
+}
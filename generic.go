@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Value holds a typed configuration value, along with whether one was found.
+type Value[T any] struct {
+	Value T
+	Found bool
+}
+
+// Resolve loops through the listed possible values to find a non-missing, non-empty one which the
+// supplied conversion function accepts, and returns the converted value. It allows any type to be
+// resolved without a dedicated method, given a function to parse it from a string.
+//
+// If no value converts successfully, you get the zero value of T and an error which includes the
+// conversion errors for any values which were rejected.
+func Resolve[T any](conv func(string) (T, error), list ...*string) (T, error) {
+	var errs []error
+	for _, elem := range list {
+		if elem != nil && *elem != "" {
+			val, err := conv(*elem)
+			if err == nil {
+				return val, nil
+			}
+			errs = append(errs, &ValueError{Value: *elem, Err: fmt.Errorf("unrecognized value '%s': %w", *elem, err), kind: ErrParse})
+		}
+	}
+	var zero T
+	errs = append(errs, missingError(fmt.Sprintf("%T", zero)))
+	return zero, errors.Join(errs...)
+}
+
+// ResolveValue is like Resolve, but appends any errors to Config.Errors in the same way as the
+// Config methods such as ResolveInt, and reports whether a value was found rather than treating a
+// missing value as an error.
+func ResolveValue[T any](c *Config, conv func(string) (T, error), list ...*string) Value[T] {
+	for _, elem := range list {
+		if c.scalar(elem) {
+			val, err := conv(*elem)
+			if err == nil {
+				return Value[T]{Value: val, Found: true}
+			}
+			c.addError(c.valueError(elem, ErrParse, fmt.Errorf("unrecognized value '%s'%s: %w", *elem, c.origin(elem), err)))
+		}
+	}
+	return Value[T]{}
+}
+
+// Get looks up a key in the config file with FromFile, and converts the value to T, which must be
+// string, bool, int, int64, float64, time.Duration or os.FileMode. Values are parsed as for the corresponding
+// Resolve method. If the key is absent, you get the zero value and false, without an error. If the
+// value can't be converted, or T isn't supported, an error is appended to Config.Errors and you get
+// the zero value and false.
+func Get[T any](c *Config, key string) (T, bool) {
+	var out T
+	elem := c.FromFile(key)
+	if elem == nil || c.isTable(elem) {
+		return out, false
+	}
+	var err error
+	switch p := any(&out).(type) {
+	case *string:
+		*p = *elem
+	case *bool:
+		var ok bool
+		if *p, ok = c.stringToBool(*elem); !ok {
+			err = fmt.Errorf("not a recognized bool")
+		}
+	case *int:
+		var n int64
+		n, err = parseInt(*elem)
+		*p = int(n)
+	case *int64:
+		*p, err = parseInt(*elem)
+	case *float64:
+		*p, err = strconv.ParseFloat(*elem, 64)
+	case *time.Duration:
+		*p, err = time.ParseDuration(*elem)
+	case *os.FileMode:
+		*p, err = c.parseFileMode(elem)
+	default:
+		c.addError(fmt.Errorf("can't get file key '%s' as unsupported type %T", key, out))
+		return out, false
+	}
+	if err != nil {
+		var zero T
+		c.addError(c.valueError(elem, ErrParse, fmt.Errorf("unrecognized %T value '%s'%s: %w", zero, *elem, c.origin(elem), err)))
+		return zero, false
+	}
+	return out, true
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logLevel is an example of a custom enum type.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarning
+)
+
+// parseLogLevel converts a string to a logLevel, for use with Resolve.
+func parseLogLevel(s string) (logLevel, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return levelDebug, nil
+	case "info":
+		return levelInfo, nil
+	case "warning":
+		return levelWarning, nil
+	}
+	return 0, fmt.Errorf("unknown log level")
+}
+
+func ExampleResolve() {
+	conf := New("MyAppName")
+	level, err := Resolve(parseLogLevel,
+		conf.FromEnv("MYAPP_LOG_LEVEL_UNSET"),
+		conf.Default("warning"),
+	)
+	fmt.Println(level, err)
+	// Output: 2 <nil>
+}
+
+func TestResolve(t *testing.T) {
+	r, err := Resolve(strconv.Atoi, nil, PS(""), PS("x"), PS("42"))
+	if r != 42 || err != nil {
+		t.Errorf("Resolve gave %v, %v, expected 42, nil", r, err)
+	}
+	r, err = Resolve(strconv.Atoi, PS("x"))
+	if r != 0 || err == nil {
+		t.Fatalf("Resolve gave %v, %v, expected 0 and an error", r, err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "'x'") || !strings.Contains(msg, "missing default int value") {
+		t.Errorf("Resolve gave error %q", msg)
+	}
+}
+
+func TestResolveValue(t *testing.T) {
+	lc := New("ResolveValue")
+	v := ResolveValue(lc, parseLogLevel, PS("loud"), PS("Info"))
+	if !v.Found || v.Value != levelInfo || len(lc.Errors) != 1 {
+		t.Errorf("ResolveValue gave %v with %d errors, expected levelInfo with 1", v, len(lc.Errors))
+	}
+	v = ResolveValue(lc, parseLogLevel, nil)
+	if v.Found || len(lc.Errors) != 1 {
+		t.Errorf("ResolveValue of missing value gave %v with %d errors", v, len(lc.Errors))
+	}
+}
+
+func TestGet(t *testing.T) {
+	lc := conf.Clone()
+	lc.Set("timeout", "1m30s")
+	lc.Set("perm", "0640")
+	if v, ok := Get[string](lc, "alpha"); !ok || v != "Some string" {
+		t.Errorf("Get[string](alpha) gave %q, %v", v, ok)
+	}
+	if v, ok := Get[int](lc, "beta"); !ok || v != 42 {
+		t.Errorf("Get[int](beta) gave %v, %v", v, ok)
+	}
+	if v, ok := Get[int64](lc, "database.port"); !ok || v != 5432 {
+		t.Errorf("Get[int64](database.port) gave %v, %v", v, ok)
+	}
+	if v, ok := Get[bool](lc, "gamma"); !ok || !v {
+		t.Errorf("Get[bool](gamma) gave %v, %v", v, ok)
+	}
+	if v, ok := Get[float64](lc, "delta"); !ok || v != 3.14159 {
+		t.Errorf("Get[float64](delta) gave %v, %v", v, ok)
+	}
+	if v, ok := Get[time.Duration](lc, "timeout"); !ok || v != 90*time.Second {
+		t.Errorf("Get[time.Duration](timeout) gave %v, %v", v, ok)
+	}
+	if v, ok := Get[os.FileMode](lc, "perm"); !ok || v != 0640 {
+		t.Errorf("Get[os.FileMode](perm) gave %v, %v", v, ok)
+	}
+	if len(lc.Errors) != 0 {
+		t.Fatalf("Get gave errors %v", lc.Errors)
+	}
+	if v, ok := Get[int](lc, "missing"); ok || v != 0 || len(lc.Errors) != 0 {
+		t.Errorf("Get[int](missing) gave %v, %v, errors %v", v, ok, lc.Errors)
+	}
+	if v, ok := Get[int](lc, "alpha"); ok || v != 0 || len(lc.Errors) != 1 {
+		t.Errorf("Get[int](alpha) gave %v, %v, errors %v", v, ok, lc.Errors)
+	}
+	if _, ok := Get[[]byte](lc, "alpha"); ok || len(lc.Errors) != 2 {
+		t.Errorf("Get[[]byte](alpha) gave %v, errors %v", ok, lc.Errors)
+	}
+}
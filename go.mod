@@ -1,5 +1,5 @@
 module github.com/lpar/config
 
-go 1.13
+go 1.20
 
-require github.com/pelletier/go-toml v1.4.0
+require github.com/pelletier/go-toml v1.8.0
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+// loadINI parses an INI file into a tree, so that `key = value` lines following a `[section]` header
+// can be looked up as `section.key`. Keys before the first section header are top-level. Lines
+// starting with `;` or `#` are comments. All values are strings; surrounding double quotes are removed.
+func loadINI(r io.Reader) (*toml.Tree, error) {
+	data := make(map[string]interface{})
+	current := data
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("INI line %d: unterminated section header", lineno)
+			}
+			section := strings.TrimSpace(line[1 : len(line)-1])
+			if section == "" {
+				return nil, fmt.Errorf("INI line %d: empty section name", lineno)
+			}
+			sub, ok := data[section].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				data[section] = sub
+			}
+			current = sub
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i < 1 {
+			return nil, fmt.Errorf("INI line %d: expected key = value", lineno)
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+			value = value[1 : len(value)-1]
+		}
+		current[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return toml.TreeFromMap(data)
+}
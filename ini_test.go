@@ -0,0 +1,63 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const INI = `
+; legacy settings
+name = legacy
+
+[server]
+host = example.com
+port: 8080
+
+# quoted values keep their spaces
+[paths]
+home = " /home/meta "
+`
+
+func TestConfig_LoadINI(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "GoLparConfigTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	fn := filepath.Join(tmpdir, "legacy.ini")
+	if err = ioutil.WriteFile(fn, []byte(INI), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lc := New("LoadINI")
+	lc.Load(fn)
+	if len(lc.Errors) != 0 {
+		t.Fatalf("Load gave errors %v", lc.Errors)
+	}
+	verify(t, "FromFile(name)", lc.FromFile("name"), "legacy")
+	verify(t, "FromFile(server.host)", lc.FromFile("server.host"), "example.com")
+	verify(t, "FromFile(server.port)", lc.FromFile("server.port"), "8080")
+	verify(t, "FromFile(paths.home)", lc.FromFile("paths.home"), " /home/meta ")
+	if lc.LoadedFormat() != "ini" {
+		t.Errorf("LoadedFormat gave %s, expected ini", lc.LoadedFormat())
+	}
+	if lc.ResolveInt(lc.FromFile("server.port")) != 8080 {
+		t.Errorf("ResolveInt(server.port) didn't give 8080")
+	}
+}
+
+func TestLoadINI_errors(t *testing.T) {
+	var tests = []string{
+		"[server\nhost = x",
+		"[]\nhost = x",
+		"host",
+		"= x",
+	}
+	for _, tt := range tests {
+		if _, err := loadINI(strings.NewReader(tt)); err == nil {
+			t.Errorf("loadINI(%q) gave no error", tt)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pelletier/go-toml"
+)
+
+// loadJSON parses a JSON object into a tree, so that nested objects can be looked up with dotted keys
+// like TOML tables. Whole numbers become integers and other numbers floats, as they would in TOML.
+// Null values are left out, so they count as missing. As in TOML, the elements of an array must all
+// be the same type, except that an array of numbers containing any non-integers becomes an array of
+// floats; arrays containing nulls, arrays or a mixture of types result in an error.
+func loadJSON(r io.Reader) (tree *toml.Tree, err error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var data map[string]interface{}
+	if err = dec.Decode(&data); err != nil {
+		return nil, fmt.Errorf("JSON config: %w", err)
+	}
+	if data == nil {
+		return nil, errors.New("JSON config must be an object")
+	}
+	if _, err = dec.Token(); err != io.EOF {
+		return nil, errors.New("JSON config has data after the object")
+	}
+	v, err := jsonToTOML("", data)
+	if err != nil {
+		return nil, fmt.Errorf("JSON config: %w", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tree, err = nil, fmt.Errorf("JSON config: %v", r)
+		}
+	}()
+	return toml.TreeFromMap(v.(map[string]interface{}))
+}
+
+// jsonToTOML converts decoded JSON values at the given key to the types used in TOML trees.
+func jsonToTOML(key string, v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n, nil
+		}
+		f, err := x.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("number %s at %s out of range", x, key)
+		}
+		return f, nil
+	case map[string]interface{}:
+		for k, e := range x {
+			if e == nil {
+				delete(x, k)
+				continue
+			}
+			ekey := k
+			if key != "" {
+				ekey = key + "." + k
+			}
+			var err error
+			if x[k], err = jsonToTOML(ekey, e); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		return jsonArray(key, x)
+	}
+	return v, nil
+}
+
+// jsonArray converts the elements of a JSON array, checking that they can form a TOML array.
+func jsonArray(key string, x []interface{}) (interface{}, error) {
+	kind := ""
+	for i, e := range x {
+		if e == nil {
+			return nil, fmt.Errorf("array %s contains null", key)
+		}
+		ev, err := jsonToTOML(fmt.Sprintf("%s[%d]", key, i), e)
+		if err != nil {
+			return nil, err
+		}
+		x[i] = ev
+		ekind := ""
+		switch ev.(type) {
+		case int64, float64:
+			ekind = "number"
+		case string:
+			ekind = "string"
+		case bool:
+			ekind = "bool"
+		case map[string]interface{}:
+			ekind = "object"
+		default:
+			return nil, fmt.Errorf("array %s contains nested arrays, which aren't supported", key)
+		}
+		if kind != "" && ekind != kind {
+			return nil, fmt.Errorf("array %s mixes %s and %s values", key, kind, ekind)
+		}
+		kind = ekind
+	}
+	if kind == "number" {
+		for _, e := range x {
+			if _, ok := e.(float64); ok {
+				for j, n := range x {
+					if i, ok := n.(int64); ok {
+						x[j] = float64(i)
+					}
+				}
+				break
+			}
+		}
+	}
+	return x, nil
+}
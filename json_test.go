@@ -0,0 +1,56 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const JSON = `{
+	"name": "generated",
+	"server": {"host": "example.com", "port": 8080, "ratio": 0.5, "tags": ["a", "b"]},
+	"unset": null
+}`
+
+func TestConfig_LoadJSON(t *testing.T) {
+	lc := New("LoadJSON")
+	if err := lc.LoadReader(strings.NewReader(JSON), "json"); err != nil {
+		t.Fatalf("LoadReader gave error %v", err)
+	}
+	verify(t, "FromFile(name)", lc.FromFile("name"), "generated")
+	verify(t, "FromFile(server.host)", lc.FromFile("server.host"), "example.com")
+	if n := lc.ResolveInt(lc.FromFile("server.port")); n != 8080 {
+		t.Errorf("ResolveInt(server.port) gave %d", n)
+	}
+	if f := lc.ResolveFloat64(lc.FromFile("server.ratio")); f != 0.5 {
+		t.Errorf("ResolveFloat64(server.ratio) gave %v", f)
+	}
+	if tags := lc.ResolveStringSlice(",", lc.FromFile("server.tags")); strings.Join(tags, " ") != "a b" {
+		t.Errorf("ResolveStringSlice(server.tags) gave %v", tags)
+	}
+	if lc.Has("unset") || len(lc.Errors) != 0 {
+		t.Errorf("LoadJSON gave unset key or errors %v", lc.Errors)
+	}
+	for _, bad := range []string{`{"a": `, `[1, 2]`, `null`, `{"a":[1,"x"]}`, `{"a":[null]}`, `{"a":[[1],[2]]}`,
+		`{"a":[{"b":1}, 2]}`, `{"a":1} trailing`, `{"a":1} {"b":2}`, `{"a":1e999}`} {
+		if err := lc.LoadReader(strings.NewReader(bad), "json"); err == nil {
+			t.Errorf("LoadReader accepted bad JSON %s", bad)
+		}
+	}
+}
+
+func TestConfig_LoadJSONArrays(t *testing.T) {
+	lc := New("LoadJSONArrays")
+	src := `{"mixed": [1, 2.5], "ints": [1, 2], "empty": [], "servers": [{"name": "a"}, {"name": "b"}]}`
+	if err := lc.LoadReader(strings.NewReader(src), "json"); err != nil {
+		t.Fatalf("LoadReader gave error %v", err)
+	}
+	if f := lc.ResolveFloatSlice(",", lc.FromFile("mixed")); len(f) != 2 || f[0] != 1 || f[1] != 2.5 {
+		t.Errorf("ResolveFloatSlice(mixed) gave %v", f)
+	}
+	if n := lc.ResolveIntSlice(",", lc.FromFile("ints")); len(n) != 2 || n[1] != 2 {
+		t.Errorf("ResolveIntSlice(ints) gave %v", n)
+	}
+	if !lc.Has("empty") || !lc.Has("servers") || len(lc.Errors) != 0 {
+		t.Errorf("LoadReader lost arrays, errors %v", lc.Errors)
+	}
+}
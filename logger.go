@@ -0,0 +1,31 @@
+package config
+
+// Logger receives messages about what the Config is doing, such as which file was loaded and which keys
+// weren't found, for observability into how configuration was resolved. Errors and warnings are passed
+// to it as they occur, as well as being recorded in Config.Errors and Config.Warnings.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// nopLogger is the default Logger, which discards everything.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Warnf(format string, args ...interface{})  {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
+
+// SetLogger sets the Logger used by the Config. Sub-configs use their parent's Logger. Passing nil
+// restores the default, which discards all messages.
+func (c *Config) SetLogger(l Logger) {
+	c.root().logger = l
+}
+
+// log returns the Logger to use, which is the parent's if the Config is a sub-config.
+func (c *Config) log() Logger {
+	if l := c.root().logger; l != nil {
+		return l
+	}
+	return nopLogger{}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recordingLogger keeps the messages logged at each level.
+type recordingLogger struct {
+	debug, warn, errs []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.debug = append(l.debug, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.warn = append(l.warn, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.errs = append(l.errs, fmt.Sprintf(format, args...))
+}
+
+func TestConfig_SetLogger(t *testing.T) {
+	lc := New("SetLogger")
+	lc.LookupEnv = fakeEnv(map[string]string{"OLD_NAME": "x"})
+	lc.ResolveInt(lc.FromFile("missing"))
+	log := &recordingLogger{}
+	lc.SetLogger(log)
+	lc.LoadReader(strings.NewReader("alpha = 1\n"), "toml")
+	lc.Sub("db").ResolveInt(lc.FromFile("missing"), lc.FromEnvAlias("NEW_NAME", "OLD_NAME"))
+	if len(log.debug) != 3 || log.debug[0] != "loaded toml config from reader" ||
+		log.debug[1] != "file key 'missing' not found" || log.debug[2] != "environment variable NEW_NAME not set" {
+		t.Errorf("unexpected debug messages %q", log.debug)
+	}
+	if len(log.warn) != 1 || !strings.Contains(log.warn[0], "OLD_NAME is deprecated") {
+		t.Errorf("unexpected warning messages %q", log.warn)
+	}
+	if len(log.errs) != 2 || !strings.Contains(log.errs[0], "unrecognized numeric value 'x'") {
+		t.Errorf("unexpected error messages %q", log.errs)
+	}
+	lc.SetLogger(nil)
+	lc.ResolveInt(nil)
+	if len(log.errs) != 2 || len(lc.Errors) != 4 {
+		t.Errorf("SetLogger(nil) didn't restore default, got %d messages and %d errors", len(log.errs), len(lc.Errors))
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Lookup builds up a list of possible values for a setting one source at a time, as an alternative to
+// nesting calls, then resolves it. Sources are checked in the order they're added, e.g.
+//
+//	host := conf.Lookup("db.host").Env("DB_HOST").File().Default("localhost").String()
+//
+// The key is used by File and DerivedEnv, and to name the setting in any error messages.
+type Lookup struct {
+	c    *Config
+	key  string
+	list []*string
+}
+
+// Lookup starts building a list of possible values for the setting with the given key.
+func (c *Config) Lookup(key string) *Lookup {
+	return &Lookup{c: c, key: key}
+}
+
+// Env adds the value of the named environment variable, as per FromEnv.
+func (l *Lookup) Env(name string) *Lookup {
+	return l.Add(l.c.FromEnv(name))
+}
+
+// DerivedEnv adds the value of the environment variable whose name EnvKey derives from the key.
+func (l *Lookup) DerivedEnv() *Lookup {
+	return l.Add(l.c.FromDerivedEnv(l.key))
+}
+
+// File adds the value for the key from the config file, as per FromFile.
+func (l *Lookup) File() *Lookup {
+	return l.Add(l.c.FromFile(l.key))
+}
+
+// FlagSet adds the value of the named flag in the flag set, if it was set on the command line. It should
+// be used after the flag set has been parsed. If there's no such flag, an error is appended to
+// Config.Errors.
+func (l *Lookup) FlagSet(fs *flag.FlagSet, name string) *Lookup {
+	f := fs.Lookup(name)
+	if f == nil {
+		l.c.addError(fmt.Errorf("flag -%s not defined", name))
+		return l
+	}
+	set := false
+	fs.Visit(func(v *flag.Flag) {
+		if v.Name == name {
+			set = true
+		}
+	})
+	if !set {
+		return l
+	}
+	v := f.Value.String()
+	return l.Add(&v)
+}
+
+// Default adds a default value, as per Config.Default.
+func (l *Lookup) Default(x interface{}) *Lookup {
+	return l.Add(l.c.Default(x))
+}
+
+// Add adds a value from any other source, such as UserHomeDir or FromSource. Nil values are ignored
+// when resolving, as usual.
+func (l *Lookup) Add(value *string) *Lookup {
+	l.list = append(l.list, value)
+	return l
+}
+
+// List returns the possible values added so far, for passing to resolvers which Lookup doesn't cover.
+func (l *Lookup) List() []*string {
+	return l.list
+}
+
+// String resolves the setting as per ResolveStringNamed.
+func (l *Lookup) String() string {
+	return l.c.ResolveStringNamed(l.key, l.list...)
+}
+
+// Int resolves the setting as per ResolveIntNamed.
+func (l *Lookup) Int() int {
+	return l.c.ResolveIntNamed(l.key, l.list...)
+}
+
+// Float64 resolves the setting as per ResolveFloat64Named.
+func (l *Lookup) Float64() float64 {
+	return l.c.ResolveFloat64Named(l.key, l.list...)
+}
+
+// Bool resolves the setting as per ResolveBoolNamed.
+func (l *Lookup) Bool() bool {
+	return l.c.ResolveBoolNamed(l.key, l.list...)
+}
+
+// Duration resolves the setting as per ResolveDurationNamed.
+func (l *Lookup) Duration() time.Duration {
+	return l.c.ResolveDurationNamed(l.key, l.list...)
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_Lookup(t *testing.T) {
+	lc := conf.Clone()
+	lc.LookupEnv = fakeEnv(map[string]string{"DB_HOST": "env.example.com", "MYAPPNAME_DATABASE_PORT": "6543"})
+	if r := lc.Lookup("database.host").Env("DB_HOST").File().Default("localhost").String(); r != "env.example.com" {
+		t.Errorf("Lookup(database.host) gave %s", r)
+	}
+	if r := lc.Lookup("database.host").Env("UNSET").File().Default("localhost").String(); r != "localhost" {
+		t.Errorf("Lookup(database.host) without env gave %s", r)
+	}
+	if r := lc.Lookup("database.port").DerivedEnv().File().Int(); r != 6543 {
+		t.Errorf("Lookup(database.port) gave %d", r)
+	}
+	if r := lc.Lookup("gamma").File().Default(false).Bool(); !r {
+		t.Errorf("Lookup(gamma) gave false")
+	}
+	if r := lc.Lookup("delta").File().Float64(); r != 3.14159 {
+		t.Errorf("Lookup(delta) gave %v", r)
+	}
+	if r := lc.Lookup("timeout").File().Default(5 * time.Second).Duration(); r != 5*time.Second {
+		t.Errorf("Lookup(timeout) gave %v", r)
+	}
+	if len(lc.Errors) != 0 {
+		t.Fatalf("unexpected errors %v", lc.Errors)
+	}
+	lc.Lookup("missing").File().Int()
+	if len(lc.Errors) != 1 || !strings.Contains(lc.Errors[0].Error(), "resolving 'missing'") {
+		t.Errorf("Lookup(missing) gave errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_LookupFlagSet(t *testing.T) {
+	lc := New("LookupFlagSet")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("host", "flagdefault", "")
+	fs.Int("port", 80, "")
+	if err := fs.Parse([]string{"-port", "8080"}); err != nil {
+		t.Fatal(err)
+	}
+	if r := lc.Lookup("port").FlagSet(fs, "port").Default(1).Int(); r != 8080 {
+		t.Errorf("Lookup(port) gave %d, expected flag value", r)
+	}
+	if r := lc.Lookup("host").FlagSet(fs, "host").Default("localhost").String(); r != "localhost" {
+		t.Errorf("Lookup(host) gave %s, expected unset flag to be skipped", r)
+	}
+	if len(lc.Errors) != 0 {
+		t.Fatalf("unexpected errors %v", lc.Errors)
+	}
+	if r := lc.Lookup("x").FlagSet(fs, "undefined").Default("y").List(); len(r) != 1 || len(lc.Errors) != 1 {
+		t.Errorf("Lookup with undefined flag gave %v, errors %v", r, lc.Errors)
+	}
+}
@@ -0,0 +1,316 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Populate fills in the fields of the struct pointed to by v, resolving each field from the sources
+// named in its struct tags, in the order environment variable, config file, then default:
+//
+//	type AppConfig struct {
+//		Port    int           `env:"PORT" file:"server.port" default:"8080"`
+//		Timeout time.Duration `file:"server.timeout" default:"30s"`
+//		Hosts   []string      `env:"HOSTS" file:"hosts"`
+//	}
+//
+// Supported field types are string, bool, the int, uint and float types, time.Duration, os.FileMode,
+// Secret, []string, []int, []float64, map[string]string, and types implementing encoding.TextUnmarshaler.
+// Values are parsed as by the corresponding Resolve method, so file modes are octal, and slices from
+// the environment are comma-separated. Nested structs without tags are populated recursively.
+//
+// Fields with no tags are left alone, as are fields for which none of the sources has a value, so
+// defaults can also be set in the struct before calling Populate. Errors name the field's key, and
+// are appended to Config.Errors as well as being returned together.
+//
+// If v implements Validator, its Validate method is called once the fields have been set, and any
+// error it returns is treated the same way.
+func (c *Config) Populate(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		err := fmt.Errorf("can't populate %T, need a pointer to a struct", v)
+		c.addError(err)
+		return err
+	}
+	n := c.errorCount()
+	known := make(map[string]bool)
+	c.populateStruct(rv.Elem(), "", false, known)
+	if c.Strict {
+		c.checkUnknown("", known)
+	}
+	c.validate(v)
+	errs, _ := c.errorsSince(n)
+	return errors.Join(errs...)
+}
+
+// Validator can be implemented by a struct passed to Populate or UnmarshalKey, to check its values once
+// they have been set, for example that a certificate path is given if TLS is enabled.
+type Validator interface {
+	Validate() error
+}
+
+// validate calls v's Validate method if it has one, and appends any error to Config.Errors.
+func (c *Config) validate(v interface{}) {
+	if vr, ok := v.(Validator); ok {
+		if err := vr.Validate(); err != nil {
+			c.addError(err)
+		}
+	}
+}
+
+// UnmarshalKey is like Populate, but binds the struct to the table with the given dotted key prefix, such
+// as `database`, so that a component can bind just its part of the config. Fields don't need tags: each
+// field is looked up in the environment variable derived from its full key by EnvKey, then in the file
+// under the prefix. The key for a field is its `file` tag if it has one, otherwise its name converted to
+// snake case, so field MaxConns with prefix `database` is looked up as MYAPP_DATABASE_MAX_CONNS, then as
+// `database.max_conns` in the file. An `env` tag replaces the derived variable name, and a `default` tag
+// supplies a default. Nested structs are bound to the table named after the field. As with Populate,
+// v's Validate method is called if it implements Validator.
+func (c *Config) UnmarshalKey(prefix string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		err := fmt.Errorf("can't unmarshal into %T, need a pointer to a struct", v)
+		c.addError(err)
+		return err
+	}
+	if prefix != "" {
+		prefix += "."
+	}
+	n := c.errorCount()
+	known := make(map[string]bool)
+	c.populateStruct(rv.Elem(), prefix, true, known)
+	if c.Strict {
+		c.checkUnknown(prefix, known)
+	}
+	c.validate(v)
+	errs, _ := c.errorsSince(n)
+	return errors.Join(errs...)
+}
+
+// populateStruct resolves the fields of a struct, recursing into struct fields. If derive is false,
+// only fields with tags are resolved, and untagged struct fields are recursed into. If derive is true,
+// keys are derived from the field names as for UnmarshalKey, relative to the prefix. The file keys of
+// the fields are added to known.
+func (c *Config) populateStruct(rv reflect.Value, prefix string, derive bool, known map[string]bool) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		env, hasEnv := field.Tag.Lookup("env")
+		file, hasFile := field.Tag.Lookup("file")
+		def, hasDefault := field.Tag.Lookup("default")
+		if derive && !hasFile {
+			file, hasFile = snakeCase(field.Name), true
+		}
+		if derive {
+			file = prefix + file
+		}
+		if derive && !hasEnv {
+			env, hasEnv = c.EnvKey(file), true
+		}
+		if field.Type.Kind() == reflect.Struct && !isLeafType(field.Type) {
+			if derive {
+				c.populateStruct(rv.Field(i), file+".", true, known)
+			} else if !hasEnv && !hasFile && !hasDefault {
+				c.populateStruct(rv.Field(i), "", false, known)
+			}
+			continue
+		}
+		if !hasEnv && !hasFile && !hasDefault {
+			continue
+		}
+		var list []*string
+		if hasEnv {
+			list = append(list, c.FromEnv(env))
+		}
+		if hasFile {
+			list = append(list, c.FromFile(file))
+			known[c.knownKey(file)] = true
+		}
+		if hasDefault {
+			list = append(list, &def)
+		}
+		name := file
+		if file == "" {
+			name = env
+		}
+		if name == "" {
+			name = field.Name
+		}
+		c.populateField(name, rv.Field(i), list)
+	}
+}
+
+// checkUnknown appends an error for each key in the config file under the prefix which isn't known,
+// and isn't within a known table such as one populating a map field. Keys in the Config.Environment
+// section are checked as if they were at the top level, and keys in other environments' sections which
+// override known keys are skipped.
+func (c *Config) checkUnknown(prefix string, known map[string]bool) {
+	for key, olds := range c.aliases {
+		if known[c.knownKey(key)] {
+			for _, old := range olds {
+				known[c.knownKey(old)] = true
+			}
+		}
+	}
+	for _, fkey := range c.Keys() {
+		key := fkey
+		if c.Environment != "" {
+			key = strings.TrimPrefix(key, c.Environment+".")
+		}
+		if !strings.HasPrefix(key, prefix) || c.coveredKey(key, known) || c.otherEnvironmentKey(key, prefix, known) {
+			continue
+		}
+		c.addError(&ValueError{Key: c.keyPrefix + fkey, Source: "file",
+			Err: fmt.Errorf("unknown file key '%s'", c.keyPrefix+fkey), kind: ErrUnknownKey})
+	}
+}
+
+// otherEnvironmentKey reports whether the key overrides a known key in the section for an environment
+// other than Config.Environment, such as `staging.port` when Environment is "production".
+func (c *Config) otherEnvironmentKey(key string, prefix string, known map[string]bool) bool {
+	if c.Environment == "" {
+		return false
+	}
+	i := strings.Index(key, ".")
+	if i < 0 || c.coveredKey(key[:i], known) {
+		return false
+	}
+	rest := key[i+1:]
+	return strings.HasPrefix(rest, prefix) && c.coveredKey(rest, known)
+}
+
+// coveredKey reports whether the key or any of the tables containing it is known.
+func (c *Config) coveredKey(key string, known map[string]bool) bool {
+	key = c.knownKey(key)
+	for {
+		if known[key] {
+			return true
+		}
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			return false
+		}
+		key = key[:i]
+	}
+}
+
+// knownKey returns the key as recorded in the set of known keys, in lower case if
+// Config.CaseInsensitiveKeys is set.
+func (c *Config) knownKey(key string) string {
+	if c.CaseInsensitiveKeys {
+		return strings.ToLower(key)
+	}
+	return key
+}
+
+// snakeCase converts a Go field name such as MaxConns or HTTPPort to snake case, max_conns or http_port.
+func snakeCase(name string) string {
+	var sb strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	fileModeType        = reflect.TypeOf(os.FileMode(0))
+	secretType          = reflect.TypeOf(Secret{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isLeafType reports whether a struct type is set as a single value rather than field by field.
+func isLeafType(t reflect.Type) bool {
+	return t == secretType || reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// populateField resolves a single field from the list of possible values, if any of them are present.
+// Errors are tagged with the name.
+func (c *Config) populateField(name string, fv reflect.Value, list []*string) {
+	defer c.debugResolve(name, list)()
+	present := false
+	for _, elem := range list {
+		if elem != nil && *elem != "" {
+			present = true
+		}
+	}
+	if !present {
+		return
+	}
+	defer c.tagErrors(name)()
+	t := fv.Type()
+	switch {
+	case t == durationType:
+		fv.SetInt(int64(c.ResolveDuration(list...)))
+		return
+	case t == fileModeType:
+		fv.SetUint(uint64(c.ResolveFileMode(list...)))
+		return
+	case t == secretType:
+		fv.Set(reflect.ValueOf(c.ResolveSecret(list...)))
+		return
+	case reflect.PtrTo(t).Implements(textUnmarshalerType):
+		s := c.ResolveString(list...)
+		if err := fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			c.addError(&ValueError{Value: s, Err: fmt.Errorf("unrecognized %s value '%s': %w", t, s, err), kind: ErrParse})
+		}
+		return
+	}
+	switch t.Kind() {
+	case reflect.String:
+		fv.SetString(c.ResolveString(list...))
+	case reflect.Bool:
+		fv.SetBool(c.ResolveBool(list...))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := c.ResolveInt(list...)
+		if fv.OverflowInt(int64(n)) {
+			c.addError(&ValueError{Err: fmt.Errorf("value %d out of range for %s", n, t), kind: ErrInvalidValue})
+			return
+		}
+		fv.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := c.ResolveInt(list...)
+		if n < 0 || fv.OverflowUint(uint64(n)) {
+			c.addError(&ValueError{Err: fmt.Errorf("value %d out of range for %s", n, t), kind: ErrInvalidValue})
+			return
+		}
+		fv.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		fv.SetFloat(c.ResolveFloat64(list...))
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.String:
+			fv.Set(reflect.ValueOf(c.ResolveStringSlice(",", list...)).Convert(t))
+		case reflect.Int:
+			fv.Set(reflect.ValueOf(c.ResolveIntSlice(",", list...)).Convert(t))
+		case reflect.Float64:
+			fv.Set(reflect.ValueOf(c.ResolveFloatSlice(",", list...)).Convert(t))
+		default:
+			c.addError(fmt.Errorf("unsupported field type %s", t))
+		}
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String || t.Elem().Kind() != reflect.String {
+			c.addError(fmt.Errorf("unsupported field type %s", t))
+			return
+		}
+		fv.Set(reflect.ValueOf(c.ResolveStringMap(list...)).Convert(t))
+	default:
+		c.addError(fmt.Errorf("unsupported field type %s", t))
+	}
+}
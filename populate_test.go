@@ -0,0 +1,231 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testServerConfig struct {
+	Host    string        `file:"database.host" default:"127.0.0.1"`
+	Port    uint16        `env:"DB_PORT" file:"database.port" default:"1"`
+	Timeout time.Duration `env:"DB_TIMEOUT" default:"30s"`
+}
+
+type testAppConfig struct {
+	Name     string            `env:"APP_NAME" file:"alpha"`
+	Answer   int               `file:"beta"`
+	Debug    bool              `file:"gamma"`
+	Pi       float64           `file:"delta"`
+	Hosts    []string          `env:"APP_HOSTS" file:"hosts"`
+	Weights  []int             `file:"weights"`
+	Headers  map[string]string `file:"headers"`
+	Password Secret            `env:"APP_PASSWORD"`
+	Bind     net.IP            `default:"10.0.0.1"`
+	Missing  string            `file:"missing"`
+	Server   testServerConfig
+	internal string `default:"x"`
+}
+
+func TestConfig_Populate(t *testing.T) {
+	lc := conf.Clone()
+	lc.LookupEnv = fakeEnv(map[string]string{"APP_HOSTS": "x.example.com, y.example.com", "APP_PASSWORD": "hunter2",
+		"DB_PORT": "6543"})
+	cfg := testAppConfig{Missing: "unchanged"}
+	if err := lc.Populate(&cfg); err != nil {
+		t.Fatalf("Populate gave error %v", err)
+	}
+	if cfg.Name != "Some string" || cfg.Answer != 42 || !cfg.Debug || cfg.Pi != 3.14159 {
+		t.Errorf("Populate gave scalars %q, %d, %v, %v", cfg.Name, cfg.Answer, cfg.Debug, cfg.Pi)
+	}
+	if strings.Join(cfg.Hosts, " ") != "x.example.com y.example.com" || len(cfg.Weights) != 3 ||
+		cfg.Headers["Accept"] != "json" {
+		t.Errorf("Populate gave %v, %v, %v", cfg.Hosts, cfg.Weights, cfg.Headers)
+	}
+	if cfg.Password.Reveal() != "hunter2" || cfg.Bind.String() != "10.0.0.1" || cfg.Missing != "unchanged" {
+		t.Errorf("Populate gave %v, %v, %q", cfg.Password, cfg.Bind, cfg.Missing)
+	}
+	if cfg.Server.Host != "localhost" || cfg.Server.Port != 6543 || cfg.Server.Timeout != 30*time.Second {
+		t.Errorf("Populate gave nested struct %+v", cfg.Server)
+	}
+	if cfg.internal != "" {
+		t.Errorf("Populate set unexported field")
+	}
+	if len(lc.Errors) != 0 {
+		t.Errorf("unexpected errors %v", lc.Errors)
+	}
+}
+
+func TestConfig_PopulateErrors(t *testing.T) {
+	lc := conf.Clone()
+	lc.LookupEnv = fakeEnv(map[string]string{"DB_PORT": "70000"})
+	var cfg testServerConfig
+	err := lc.Populate(&cfg)
+	if err == nil || len(lc.Errors) != 1 {
+		t.Fatalf("Populate gave %v, errors %v", err, lc.Errors)
+	}
+	if !errors.Is(err, ErrInvalidValue) || !strings.Contains(err.Error(), "resolving 'database.port'") {
+		t.Errorf("Populate gave error %v", err)
+	}
+	if cfg.Host != "localhost" {
+		t.Errorf("Populate didn't set other fields after an error")
+	}
+	if err = lc.Populate(cfg); err == nil {
+		t.Errorf("Populate of non-pointer didn't give an error")
+	}
+}
+
+type testDBConfig struct {
+	Host     string
+	Port     int
+	MaxConns int    `default:"10"`
+	User     string `file:"username" env:"DB_USER"`
+	TLS      struct {
+		CertFile string
+	}
+}
+
+func TestConfig_UnmarshalKey(t *testing.T) {
+	lc := conf.Clone()
+	lc.AppName = "myapp"
+	lc.LookupEnv = fakeEnv(map[string]string{"MYAPP_DATABASE_PORT": "6543", "DB_USER": "admin",
+		"MYAPP_DATABASE_TLS_CERT_FILE": "/etc/db.pem"})
+	var db testDBConfig
+	if err := lc.UnmarshalKey("database", &db); err != nil {
+		t.Fatalf("UnmarshalKey gave error %v", err)
+	}
+	if db.Host != "localhost" || db.Port != 6543 || db.MaxConns != 10 || db.User != "admin" ||
+		db.TLS.CertFile != "/etc/db.pem" {
+		t.Errorf("UnmarshalKey gave %+v", db)
+	}
+	lc.EnvPrefix = "DB_"
+	lc.LookupEnv = fakeEnv(map[string]string{"DB_DATABASE_PORT": "bad"})
+	err := lc.UnmarshalKey("database", &db)
+	if !errors.Is(err, ErrParse) || !strings.Contains(err.Error(), "resolving 'database.port'") {
+		t.Errorf("UnmarshalKey gave error %v", err)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{"Host": "host", "MaxConns": "max_conns", "HTTPPort": "http_port",
+		"TLS": "tls", "CertFile2": "cert_file2"} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+var errNoCert = errors.New("cert_file required when TLS is enabled")
+
+type testTLSConfig struct {
+	Enabled  bool
+	CertFile string
+}
+
+func (t *testTLSConfig) Validate() error {
+	if t.Enabled && t.CertFile == "" {
+		return errNoCert
+	}
+	return nil
+}
+
+func TestConfig_Validate(t *testing.T) {
+	lc := conf.Clone()
+	lc.LookupEnv = fakeEnv(map[string]string{"VALIDATE_TLS_ENABLED": "true"})
+	lc.AppName = "validate"
+	var tls testTLSConfig
+	if err := lc.UnmarshalKey("tls", &tls); !errors.Is(err, errNoCert) || len(lc.Errors) != 1 {
+		t.Fatalf("UnmarshalKey gave %v, errors %v", err, lc.Errors)
+	}
+	lc.ClearErrors()
+	lc.LookupEnv = fakeEnv(map[string]string{"VALIDATE_TLS_ENABLED": "true", "VALIDATE_TLS_CERT_FILE": "/x.pem"})
+	if err := lc.UnmarshalKey("tls", &tls); err != nil {
+		t.Errorf("UnmarshalKey gave %v for valid config", err)
+	}
+}
+
+func TestConfig_Strict(t *testing.T) {
+	lc := New("strict")
+	if err := lc.LoadReader(strings.NewReader("[database]\nhost = \"x\"\nprot = 1\nusername = \"u\"\n"+
+		"[database.tls]\ncert_file = \"c\"\nkey = \"k\"\n[other]\nx = 1\n"), "toml"); err != nil {
+		t.Fatal(err)
+	}
+	var db testDBConfig
+	if err := lc.UnmarshalKey("database", &db); err != nil {
+		t.Fatalf("UnmarshalKey gave %v without Strict", err)
+	}
+	lc.Strict = true
+	err := lc.UnmarshalKey("database", &db)
+	if !errors.Is(err, ErrUnknownKey) || len(lc.Errors) != 2 {
+		t.Fatalf("UnmarshalKey gave %v, errors %v", err, lc.Errors)
+	}
+	if lc.Errors[0].Error() != "unknown file key 'database.prot'" ||
+		lc.Errors[1].Error() != "unknown file key 'database.tls.key'" {
+		t.Errorf("UnmarshalKey gave errors %v", lc.Errors)
+	}
+	lc.ClearErrors()
+	lc.Alias("database.prot", "database.port")
+	var cfg struct {
+		Headers map[string]string `file:"headers"`
+		Port    int               `file:"database.port"`
+	}
+	lc.Set("headers.accept", "json")
+	lc.Populate(&cfg)
+	var unknown []string
+	for _, err := range lc.Errors {
+		var ve *ValueError
+		if errors.As(err, &ve) && errors.Is(err, ErrUnknownKey) {
+			unknown = append(unknown, ve.Key)
+		}
+	}
+	expected := "database.host database.tls.cert_file database.tls.key database.username other.x"
+	if strings.Join(unknown, " ") != expected || cfg.Port != 1 || len(lc.Errors) != len(unknown) {
+		t.Errorf("Populate gave unknown keys %v, expected %s, errors %v", unknown, expected, lc.Errors)
+	}
+}
+
+func TestConfig_StrictEnvironment(t *testing.T) {
+	lc := New("strictenv")
+	if err := lc.LoadReader(strings.NewReader("port = 80\n[production]\nport = 443\nhots = \"x\"\n"+
+		"[staging]\nport = 8443\nprot = 1\n"), "toml"); err != nil {
+		t.Fatal(err)
+	}
+	lc.Strict = true
+	lc.Environment = "production"
+	var cfg struct {
+		Port int `file:"port"`
+	}
+	lc.Populate(&cfg)
+	var unknown []string
+	for _, err := range lc.Errors {
+		var ve *ValueError
+		if errors.As(err, &ve) && errors.Is(err, ErrUnknownKey) {
+			unknown = append(unknown, ve.Key)
+		}
+	}
+	expected := "production.hots staging.prot"
+	if strings.Join(unknown, " ") != expected || cfg.Port != 443 || len(lc.Errors) != len(unknown) {
+		t.Errorf("Populate gave unknown keys %v, expected %s, errors %v", unknown, expected, lc.Errors)
+	}
+}
+
+func TestConfig_PopulateFileMode(t *testing.T) {
+	lc := New("PopulateFileMode")
+	lc.Set("perm", int64(0o700))
+	lc.LookupEnv = fakeEnv(map[string]string{"UMASK": "0022", "BAD_MODE": "0999"})
+	var cfg struct {
+		Perm  os.FileMode `file:"perm"`
+		Umask os.FileMode `env:"UMASK"`
+		Dir   os.FileMode `env:"BAD_MODE" default:"0755"`
+	}
+	err := lc.Populate(&cfg)
+	if cfg.Perm != 0700 || cfg.Umask != 0022 || cfg.Dir != 0755 {
+		t.Errorf("Populate gave modes %v, %v, %v", cfg.Perm, cfg.Umask, cfg.Dir)
+	}
+	if !errors.Is(err, ErrParse) || len(lc.Errors) != 1 {
+		t.Errorf("Populate gave error %v, errors %v", err, lc.Errors)
+	}
+}
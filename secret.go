@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"io"
+)
+
+// Secret holds a sensitive configuration value such as a password or API key. It formats as `***`
+// however it's printed, and marshals to `"***"`, so that it can't leak into logs by accident.
+// Use Reveal to get the actual value.
+//
+// The value is held behind a pointer, so that when a Secret is in an unexported struct field, where fmt
+// can't call its methods and prints the fields using reflection instead, only an address is shown.
+type Secret struct {
+	value *string
+}
+
+// Redacted is what a Secret shows instead of its value.
+const Redacted = "***"
+
+// Reveal returns the actual value of the secret.
+func (s Secret) Reveal() string {
+	if s.value == nil {
+		return ""
+	}
+	return *s.value
+}
+
+// IsEmpty reports whether the secret has no value, without revealing it.
+func (s Secret) IsEmpty() bool {
+	return s.Reveal() == ""
+}
+
+// String returns Redacted.
+func (s Secret) String() string {
+	return Redacted
+}
+
+// GoString returns Redacted, so that %#v doesn't show the value either.
+func (s Secret) GoString() string {
+	return Redacted
+}
+
+// Format writes Redacted for every formatting verb.
+func (s Secret) Format(f fmt.State, verb rune) {
+	io.WriteString(f, Redacted)
+}
+
+// MarshalText returns Redacted, which is also used for JSON.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(Redacted), nil
+}
+
+// ResolveSecret loops through the listed possible values to find a non-missing one, like ResolveString,
+// and returns it as a Secret. Error messages don't include the value. If no values are present, you get
+// an empty Secret.
+func (c *Config) ResolveSecret(list ...*string) Secret {
+	if elem := c.resolveString(list); elem != nil {
+		x := *elem
+		return Secret{value: &x}
+	}
+	c.addError(missingError("secret"))
+	return Secret{}
+}
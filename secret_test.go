@@ -0,0 +1,44 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestConfig_ResolveSecret(t *testing.T) {
+	lc := New("ResolveSecret")
+	s := lc.ResolveSecret(nil, PS("hunter2"), PS("other"))
+	if s.Reveal() != "hunter2" {
+		t.Errorf("Reveal gave %q, expected hunter2", s.Reveal())
+	}
+	for _, format := range []string{"%v", "%s", "%q", "%#v", "%+v", "%x", "%d", "%10s"} {
+		if out := fmt.Sprintf(format, s); strings.Contains(out, "hunter2") || !strings.Contains(out, Redacted) {
+			t.Errorf("Sprintf(%s) gave %q", format, out)
+		}
+	}
+	if out := fmt.Sprintf("%v", struct{ Password Secret }{s}); strings.Contains(out, "hunter2") {
+		t.Errorf("secret in struct printed as %q", out)
+	}
+	type dbConf struct {
+		user string
+		pw   Secret
+	}
+	for _, format := range []string{"%v", "%+v", "%#v"} {
+		if out := fmt.Sprintf(format, dbConf{"u", s}); strings.Contains(out, "hunter2") {
+			t.Errorf("Sprintf(%s) of secret in unexported field gave %q", format, out)
+		}
+	}
+	b, err := json.Marshal(map[string]Secret{"password": s})
+	if err != nil || string(b) != `{"password":"***"}` {
+		t.Errorf("json.Marshal gave %s, %v", b, err)
+	}
+	if len(lc.Errors) != 0 {
+		t.Errorf("unexpected errors %v", lc.Errors)
+	}
+	if s = lc.ResolveSecret(nil); !s.IsEmpty() || len(lc.Errors) != 1 || !errors.Is(lc.Errors[0], ErrMissingValue) {
+		t.Errorf("missing secret gave %q, errors %v", s.Reveal(), lc.Errors)
+	}
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+var (
+	tomlKeyRE    = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+	tomlHeaderRE = regexp.MustCompile(`^\s*\[\s*([A-Za-z0-9_-]+(?:\s*\.\s*[A-Za-z0-9_-]+)*)\s*\]\s*(#.*)?$`)
+	tomlAssignRE = regexp.MustCompile(`^(\s*)([A-Za-z0-9_-]+(?:\s*\.\s*[A-Za-z0-9_-]+)*)\s*=\s*`)
+)
+
+// editTOML updates TOML source text with the values the given keys have in the tree, changing only the
+// lines which set those keys, so that comments and formatting elsewhere are preserved. Keys which
+// aren't already in the text are added to the end of their table. Keys which aren't in the tree are
+// ignored. It returns false if the edit can't be made safely, for example because a value is a table
+// or the key is set by a multi-line string, in which case the whole file should be rewritten instead.
+func editTOML(src string, tree *toml.Tree, keys []string) (string, bool) {
+	lines := strings.Split(src, "\n")
+	var edited []string
+	for _, key := range keys {
+		v := tree.Get(key)
+		if v == nil {
+			continue
+		}
+		text, ok := tomlValue(v)
+		if !ok || !tomlKeyRE.MatchString(key) {
+			return "", false
+		}
+		if lines, ok = setTOMLKey(lines, key, text); !ok {
+			return "", false
+		}
+		edited = append(edited, key)
+	}
+	out := strings.Join(lines, "\n")
+	check, err := toml.Load(out)
+	if err != nil {
+		return "", false
+	}
+	for _, key := range edited {
+		want, _ := tomlValue(tree.Get(key))
+		if got, ok := tomlValue(check.Get(key)); !ok || got != want {
+			return "", false
+		}
+	}
+	return out, true
+}
+
+// tomlValue formats a single value as it would appear on the right hand side of a TOML assignment.
+// It returns false for tables and for values which can't be written on a single line.
+func tomlValue(v interface{}) (string, bool) {
+	switch v.(type) {
+	case nil, *toml.Tree, []*toml.Tree, map[string]interface{}:
+		return "", false
+	}
+	tree, err := toml.TreeFromMap(map[string]interface{}{"v": v})
+	if err != nil {
+		return "", false
+	}
+	s, err := tree.ToTomlString()
+	if err != nil || !strings.HasPrefix(s, "v = ") {
+		return "", false
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "v = "), "\n")
+	return s, !strings.Contains(s, "\n")
+}
+
+// setTOMLKey replaces the value of the key in the lines of TOML text, keeping any comment following it,
+// or adds the key to its table if it isn't present.
+func setTOMLKey(lines []string, key string, text string) ([]string, bool) {
+	const unknown = "\x00" // Table name used within arrays of tables and headers we can't parse
+	table := ""
+	last := map[string]int{"": -1} // Last line of each table's content
+	indent := map[string]string{}
+	firstHeader := -1
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if firstHeader < 0 {
+				firstHeader = i
+			}
+			table = unknown
+			if m := tomlHeaderRE.FindStringSubmatch(line); m != nil {
+				table = stripSpace(m[1])
+				last[table] = i
+			}
+			continue
+		}
+		m := tomlAssignRE.FindStringSubmatchIndex(line)
+		if m == nil {
+			continue
+		}
+		full := stripSpace(line[m[4]:m[5]])
+		if table != "" {
+			full = table + "." + full
+		}
+		endLine, endCol, ok := scanTOMLValue(lines, i, m[1])
+		if !ok {
+			if full == key {
+				return nil, false
+			}
+			continue
+		}
+		if full == key {
+			lines[i] = line[:m[1]] + text + lines[endLine][endCol:]
+			return append(lines[:i+1], lines[endLine+1:]...), true
+		}
+		if table != unknown {
+			last[table] = endLine
+			indent[table] = line[m[2]:m[3]]
+		}
+		i = endLine
+	}
+	parent, name := "", key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		parent, name = key[:i], key[i+1:]
+	}
+	n, ok := last[parent]
+	switch {
+	case !ok:
+		at := len(lines)
+		if at > 0 && lines[at-1] == "" {
+			at--
+		}
+		return insertLines(lines, at, "", "["+parent+"]", name+" = "+text), true
+	case n < 0 && firstHeader < 0:
+		return insertLines(lines, len(lines), name+" = "+text), true
+	case n < 0:
+		at := firstHeader
+		for at > 0 && strings.HasPrefix(strings.TrimSpace(lines[at-1]), "#") {
+			at--
+		}
+		return insertLines(lines, at, name+" = "+text, ""), true
+	}
+	return insertLines(lines, n+1, indent[parent]+name+" = "+text), true
+}
+
+// scanTOMLValue finds the end of the value which starts at the given column of the given line,
+// allowing for arrays and inline tables spanning several lines. It returns the line and column just
+// after the value, or false for multi-line strings.
+func scanTOMLValue(lines []string, i int, col int) (int, int, bool) {
+	depth := 0
+	for ; i < len(lines); i, col = i+1, 0 {
+		line := lines[i]
+		end := col
+		for j := col; j < len(line); j++ {
+			ch := line[j]
+			switch {
+			case ch == '#':
+				j = len(line)
+				continue
+			case ch == '"' || ch == '\'':
+				if strings.HasPrefix(line[j:], `"""`) || strings.HasPrefix(line[j:], `'''`) {
+					return 0, 0, false
+				}
+				k := j + 1
+				for k < len(line) && line[k] != ch {
+					if ch == '"' && line[k] == '\\' {
+						k++
+					}
+					k++
+				}
+				j = k
+			case ch == '[' || ch == '{':
+				depth++
+			case ch == ']' || ch == '}':
+				depth--
+			case ch == ' ' || ch == '\t' || ch == '\r':
+				continue
+			}
+			end = j + 1
+		}
+		if depth <= 0 {
+			if end > len(line) {
+				end = len(line)
+			}
+			return i, end, true
+		}
+	}
+	return 0, 0, false
+}
+
+// tomlComment returns the comment lines directly above line i of the TOML text, followed by the comment
+// at the end of line i, with the comment markers removed.
+func tomlComment(lines []string, i int) string {
+	if i >= len(lines) {
+		return ""
+	}
+	var comments []string
+	for j := i - 1; j >= 0; j-- {
+		trimmed := strings.TrimSpace(lines[j])
+		if !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		comments = append([]string{commentText(trimmed)}, comments...)
+	}
+	if m := tomlAssignRE.FindStringIndex(lines[i]); m != nil {
+		if _, end, ok := scanTOMLValue(lines[i:i+1], 0, m[1]); ok {
+			if rest := strings.TrimSpace(lines[i][end:]); strings.HasPrefix(rest, "#") {
+				comments = append(comments, commentText(rest))
+			}
+		}
+	}
+	return strings.Join(comments, "\n")
+}
+
+// commentText removes the `#` and surrounding whitespace from a comment.
+func commentText(s string) string {
+	return strings.TrimSpace(strings.TrimLeft(s, "#"))
+}
+
+// insertLines returns the lines with extra lines inserted before index at.
+func insertLines(lines []string, at int, extra ...string) []string {
+	out := make([]string, 0, len(lines)+len(extra))
+	out = append(out, lines[:at]...)
+	out = append(out, extra...)
+	return append(out, lines[at:]...)
+}
+
+// stripSpace removes the spaces and tabs from a dotted key such as `a . b`.
+func stripSpace(s string) string {
+	return strings.NewReplacer(" ", "", "\t", "").Replace(s)
+}
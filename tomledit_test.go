@@ -0,0 +1,40 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/pelletier/go-toml"
+)
+
+func TestEditTOML(t *testing.T) {
+	tests := []struct {
+		src    string
+		key    string
+		value  interface{}
+		output string
+	}{
+		{"a = 1 # one\n", "a", int64(2), "a = 2 # one\n"},
+		{"a = [\n  1, # one\n  2,\n] # list\nb = 3\n", "a", []interface{}{int64(4)}, "a = [4] # list\nb = 3\n"},
+		{"a = \"x # y\" # z\n", "a", "w", "a = \"w\" # z\n"},
+		{"[t]\n  x.y = 1\n", "t.x.y", int64(5), "[t]\n  x.y = 5\n"},
+		{"[t]\n  a = 1\n\n[u]\n", "t.b", "s", "[t]\n  a = 1\n  b = \"s\"\n\n[u]\n"},
+		{"a = 1\n", "new.key", false, "a = 1\n\n[new]\nkey = false\n"},
+		{"[[s]]\nk = 1\n[t]\n", "k", int64(2), "k = 2\n\n[[s]]\nk = 1\n[t]\n"},
+	}
+	for _, test := range tests {
+		tree, err := toml.Load(test.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Set(test.key, test.value)
+		out, ok := editTOML(test.src, tree, []string{test.key})
+		if !ok || out != test.output {
+			t.Errorf("editTOML(%q, %s) gave %q, %v, expected %q", test.src, test.key, out, ok, test.output)
+		}
+	}
+	tree, _ := toml.Load("s = '''\nlong\n'''\n")
+	tree.Set("s", "short")
+	if _, ok := editTOML("s = '''\nlong\n'''\n", tree, []string{"s"}); ok {
+		t.Errorf("editTOML edited a multi-line string")
+	}
+}